@@ -0,0 +1,79 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/env"
+)
+
+// setAutoApplyCommand implements direnv enable and disable, which save the
+// choice globally or, with --here, for the current directory and below.
+func setAutoApplyCommand(enabled bool, args []string) error {
+	name := "disable"
+	if enabled {
+		name = "enable"
+	}
+	here := false
+	for _, arg := range args {
+		if arg != "--here" {
+			return fmt.Errorf("usage: direnv %s [--here]", name)
+		}
+		here = true
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	settings, err := config.LoadSettings()
+	if err != nil {
+		return err
+	}
+
+	if here {
+		if settings.Directories == nil {
+			settings.Directories = make(map[string]bool)
+		}
+		settings.Directories[cwd] = enabled
+	} else {
+		settings.AutoApply = &enabled
+	}
+	if err := settings.Save(); err != nil {
+		return err
+	}
+
+	state := "disabled"
+	if enabled {
+		state = "enabled"
+	}
+	if here {
+		fmt.Printf("Auto-apply %s for %s and below\n", state, cwd)
+	} else {
+		fmt.Printf("Auto-apply %s globally\n", state)
+	}
+
+	// Say so if a choice that takes precedence still decides here
+	cfg, _, _ := config.FindConfig(cwd)
+	if decision := env.DecideAutoApply(cwd, cfg, settings); decision.Enabled != enabled {
+		fmt.Printf("Note: here it stays %s by the %s, which takes precedence\n", map[bool]string{true: "enabled", false: "disabled"}[decision.Enabled], decision.Source)
+	}
+	return nil
+}
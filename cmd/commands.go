@@ -0,0 +1,167 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/TierOne-Software/direnv/env"
+)
+
+// command is an entry of the registry that dispatch, the usage text and
+// shell completion are all generated from.
+type command struct {
+	name    string
+	summary string
+	flags   []flag
+	// args complete the positional arguments in order. With variadic, the
+	// last one also completes all that follow.
+	args     []completer
+	variadic bool
+	// passArgs leaves everything after the first argument to it, as direnv
+	// run does for the script's arguments
+	passArgs bool
+	hidden   bool
+	run      func(args []string) error
+}
+
+// flag is a command line flag, written with its dashes.
+type flag struct {
+	name    string
+	alias   string
+	summary string
+	// value names the flag's argument, "" for a switch
+	value    string
+	complete completer
+}
+
+// globalFlags are accepted before or after any command.
+var globalFlags = []flag{
+	{name: "--shell", summary: "Generate code for this shell instead of the detected one", value: "shell", complete: completeShells},
+}
+
+// commands is initialized in init, as completion refers back to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "apply", summary: "Apply directory environment", run: noArgs(applyCommand)},
+		{name: "diff", summary: "Show what would change", run: noArgs(diffCommand)},
+		{name: "info", summary: "Show current status", run: noArgs(infoCommand)},
+		{name: "enable", summary: "Enable auto-apply (--here for this directory)",
+			flags: []flag{{name: "--here", summary: "Only for this directory and below"}},
+			run:   func(args []string) error { return setAutoApplyCommand(true, args) }},
+		{name: "disable", summary: "Disable auto-apply (--here for this directory)",
+			flags: []flag{{name: "--here", summary: "Only for this directory and below"}},
+			run:   func(args []string) error { return setAutoApplyCommand(false, args) }},
+		{name: "init", summary: "Initialize shell integration", args: []completer{completeShells}, run: initCommand},
+		{name: "install", summary: "Install shell integration into your shell config", run: installCommand},
+		{name: "uninstall", summary: "Remove shell integration from your shell config", run: uninstallCommand},
+		{name: "hook", summary: "Print shell integration with completions (eval in your shell config)", args: []completer{completeShells}, run: hookCommand},
+		{name: "export", summary: "Apply or unload for the current directory (used by the shell integration)", args: []completer{completeShells}, run: exportCommand},
+		{name: "prompt", summary: "Print a prompt segment for the applied environment",
+			flags: []flag{
+				{name: "--format", summary: "Segment with {project}, {profile}, {dir} and {warning}", value: "format"},
+				{name: "--json", summary: "Print the status as JSON"},
+			},
+			run: promptCommand},
+		{name: "completion", summary: "Generate shell completion", args: []completer{completeShells}, run: completionCommand},
+		{name: "doctor", summary: "Diagnose configuration issues", run: noArgs(doctorCommand)},
+		{name: "cleanup", summary: "Clean up orphaned state files", run: noArgs(cleanupCommand)},
+		{name: "restore", summary: "Restore previous environment", run: noArgs(restoreCommand)},
+		{name: "run", summary: "Run a script from the config with optional arguments",
+			args: []completer{completeScripts, completeScriptArgs}, variadic: true, passArgs: true,
+			run: func(args []string) error {
+				if len(args) < 1 {
+					return fmt.Errorf("usage: direnv run <script-name> [args...]")
+				}
+				return runScriptCommand(args[0], args[1:])
+			}},
+		{name: "secret", summary: "Encrypt, decrypt and rekey config secrets",
+			args: []completer{completeSecretCommands, completeSecretArgs}, variadic: true, run: secretCommand},
+		{name: "hooks", summary: "Show the status of on_change hooks",
+			args: []completer{choices(candidate{"status", "Show on_change hooks and their fingerprints"})}, run: hooksCommand},
+		{name: "jobs", summary: "List background hook jobs", run: noArgs(jobsCommand)},
+		{name: "up", summary: "Start project services", args: []completer{completeServices}, variadic: true, run: upCommand},
+		{name: "down", summary: "Stop project services", args: []completer{completeServices}, variadic: true, run: downCommand},
+		{name: "ps", summary: "Show project services", run: noArgs(psCommand)},
+		{name: "logs", summary: "Show the log of a service",
+			flags: []flag{{name: "--follow", alias: "-f", summary: "Keep printing new output"}},
+			args:  []completer{completeServices}, run: logsCommand},
+		{name: completeCommand, hidden: true, run: completeWordsCommand},
+		{name: env.SuperviseCommand, hidden: true, run: func(args []string) error {
+			if len(args) < 1 {
+				return fmt.Errorf("usage: direnv %s <service-record>", env.SuperviseCommand)
+			}
+			return env.Supervise(args[0])
+		}},
+	}
+}
+
+// noArgs adapts a command that takes no arguments.
+func noArgs(run func() error) func([]string) error {
+	return func([]string) error { return run() }
+}
+
+func lookupCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// lookupFlag finds arg, which may carry its value after "=", among the
+// global flags and those of cmd, which may be nil.
+func lookupFlag(cmd *command, arg string) *flag {
+	name, _, _ := strings.Cut(arg, "=")
+	flags := globalFlags
+	if cmd != nil {
+		flags = append(append([]flag{}, cmd.flags...), globalFlags...)
+	}
+	for i := range flags {
+		if flags[i].name == name || (flags[i].alias != "" && flags[i].alias == name) {
+			return &flags[i]
+		}
+	}
+	return nil
+}
+
+// usage lists the global flags and the commands that aren't hidden.
+func usage() string {
+	var b strings.Builder
+	b.WriteString("usage: direnv <command> [args]\n\nOptions:\n")
+	for _, f := range globalFlags {
+		fmt.Fprintf(&b, "  %s <%s> - %s\n", f.name, f.value, f.summary)
+	}
+	b.WriteString("\nCommands:")
+
+	width := 0
+	for _, c := range commands {
+		if !c.hidden && len(c.name) > width {
+			width = len(c.name)
+		}
+	}
+	for _, c := range commands {
+		if !c.hidden {
+			fmt.Fprintf(&b, "\n  %-*s - %s", width, c.name, c.summary)
+		}
+	}
+	return b.String()
+}
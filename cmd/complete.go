@@ -0,0 +1,318 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/shell"
+)
+
+// completeCommand is run by the completion scripts with the words typed
+// so far and prints the candidates for the word being completed.
+const completeCommand = "__complete"
+
+// filesCandidate asks the shell to complete file names instead.
+const filesCandidate = ":files"
+
+// candidate is a completion, with an optional description for the shells
+// that show one.
+type candidate struct {
+	word        string
+	description string
+}
+
+// completer returns the candidates for an argument given the positional
+// arguments of the command before it.
+type completer func(prev []string) []candidate
+
+// completeFiles leaves the argument to the shell's file name completion.
+var completeFiles = []candidate{{word: filesCandidate}}
+
+// completeWordsCommand implements direnv __complete. Shells pass the word
+// being completed as --current=<word>, which is never empty, followed by
+// the words after direnv before it. tcsh passes --line instead and the
+// command line in COMMAND_LINE, and gets the words without descriptions.
+// Words after either are put in front, as script functions do with
+// "run <script>".
+func completeWordsCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: direnv %s --current=<word> [words...] | --line [words...]", completeCommand)
+	}
+
+	var words []string
+	var current string
+	plain := false
+	switch {
+	case strings.HasPrefix(args[0], "--current="):
+		current = strings.TrimPrefix(args[0], "--current=")
+		words = args[1:]
+	case args[0] == "--line":
+		line := os.Getenv("COMMAND_LINE")
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			fields = fields[1:]
+		}
+		if len(fields) > 0 && !strings.HasSuffix(line, " ") {
+			current = fields[len(fields)-1]
+			fields = fields[:len(fields)-1]
+		}
+		words = append(append([]string{}, args[1:]...), fields...)
+		plain = true
+	default:
+		return fmt.Errorf("usage: direnv %s --current=<word> [words...] | --line [words...]", completeCommand)
+	}
+
+	for _, c := range completeWords(words, current) {
+		switch {
+		case plain && c.word == filesCandidate:
+		case plain || c.description == "":
+			fmt.Println(c.word)
+		default:
+			fmt.Printf("%s\t%s\n", c.word, c.description)
+		}
+	}
+	return nil
+}
+
+// completeWords returns the candidates for current, following words on
+// the command line after direnv.
+func completeWords(words []string, current string) []candidate {
+	var cmd *command
+	var prev []string
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if cmd != nil && cmd.passArgs && len(prev) > 0 {
+			prev = append(prev, word)
+			continue
+		}
+		if strings.HasPrefix(word, "-") {
+			if f := lookupFlag(cmd, word); f != nil && f.value != "" && !strings.Contains(word, "=") {
+				// The flag's value follows it
+				i++
+				if i == len(words) {
+					return filterCandidates(complete(f.complete, nil), current)
+				}
+			}
+			continue
+		}
+		if cmd == nil {
+			if cmd = lookupCommand(word); cmd == nil {
+				return nil
+			}
+			continue
+		}
+		prev = append(prev, word)
+	}
+
+	if strings.HasPrefix(current, "-") && !(cmd != nil && cmd.passArgs && len(prev) > 0) {
+		return completeFlags(cmd, current)
+	}
+	if cmd == nil {
+		var candidates []candidate
+		for _, c := range commands {
+			if !c.hidden {
+				candidates = append(candidates, candidate{c.name, c.summary})
+			}
+		}
+		return filterCandidates(candidates, current)
+	}
+
+	var arg completer
+	switch {
+	case len(prev) < len(cmd.args):
+		arg = cmd.args[len(prev)]
+	case cmd.variadic && len(cmd.args) > 0:
+		arg = cmd.args[len(cmd.args)-1]
+	}
+	return filterCandidates(complete(arg, prev), current)
+}
+
+// completeFlags completes a word starting with a dash: the flags of cmd and
+// the global ones, or the value of a flag written as --flag=value.
+func completeFlags(cmd *command, current string) []candidate {
+	if name, value, ok := strings.Cut(current, "="); ok {
+		f := lookupFlag(cmd, name)
+		if f == nil || f.value == "" {
+			return nil
+		}
+		var candidates []candidate
+		for _, c := range filterCandidates(complete(f.complete, nil), value) {
+			if c.word != filesCandidate {
+				candidates = append(candidates, candidate{name + "=" + c.word, c.description})
+			}
+		}
+		return candidates
+	}
+
+	var candidates []candidate
+	if cmd != nil {
+		for _, f := range cmd.flags {
+			candidates = append(candidates, candidate{f.name, f.summary})
+		}
+	}
+	for _, f := range globalFlags {
+		candidates = append(candidates, candidate{f.name, f.summary})
+	}
+	return filterCandidates(candidates, current)
+}
+
+func complete(c completer, prev []string) []candidate {
+	if c == nil {
+		return nil
+	}
+	return c(prev)
+}
+
+// filterCandidates keeps the candidates starting with prefix, and a request
+// for file names.
+func filterCandidates(candidates []candidate, prefix string) []candidate {
+	var matching []candidate
+	for _, c := range candidates {
+		if c.word == filesCandidate || strings.HasPrefix(c.word, prefix) {
+			matching = append(matching, c)
+		}
+	}
+	return matching
+}
+
+// choices completes to fixed words.
+func choices(candidates ...candidate) completer {
+	return func([]string) []candidate { return candidates }
+}
+
+func completeShells([]string) []candidate {
+	var candidates []candidate
+	for _, shellType := range shell.Supported() {
+		candidates = append(candidates, candidate{word: string(shellType)})
+	}
+	return candidates
+}
+
+// completionConfig loads the config of the current project without
+// resolving its sources, which may run commands. It returns nil outside a
+// project or if the config doesn't load.
+func completionConfig() (*config.Config, string) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, ""
+	}
+	configPath := config.FindConfigPath(cwd)
+	if configPath == "" {
+		return nil, ""
+	}
+	cfg, err := config.LoadProjectConfig(configPath)
+	if err != nil {
+		return nil, ""
+	}
+	return cfg, configPath
+}
+
+func completeScripts([]string) []candidate {
+	cfg, _ := completionConfig()
+	if cfg == nil {
+		return nil
+	}
+	var candidates []candidate
+	for _, name := range sortedKeys(cfg.Scripts) {
+		candidates = append(candidates, candidate{name, firstLine(cfg.Scripts[name])})
+	}
+	return candidates
+}
+
+// completeScriptArgs completes the arguments of the script named by the
+// first argument as it declares. Scripts that don't complete their
+// arguments get file names.
+func completeScriptArgs(prev []string) []candidate {
+	cfg, configPath := completionConfig()
+	if cfg == nil || len(prev) == 0 {
+		return nil
+	}
+	completion, ok := cfg.ScriptCompletions[prev[0]]
+	if !ok {
+		return completeFiles
+	}
+	words, err := completion.Candidates(filepath.Dir(configPath), prev[1:])
+	if err != nil {
+		return nil
+	}
+	candidates := make([]candidate, 0, len(words))
+	for _, word := range words {
+		candidates = append(candidates, candidate{word: word})
+	}
+	return candidates
+}
+
+func completeServices([]string) []candidate {
+	cfg, _ := completionConfig()
+	if cfg == nil {
+		return nil
+	}
+	var candidates []candidate
+	for _, name := range sortedKeys(cfg.Services) {
+		candidates = append(candidates, candidate{name, firstLine(cfg.Services[name].Run)})
+	}
+	return candidates
+}
+
+var completeSecretCommands = choices(
+	candidate{"encrypt", "Encrypt a value"},
+	candidate{"decrypt", "Decrypt a config variable or an encrypted value"},
+	candidate{"rekey", "Re-encrypt all secrets in config files to the current recipients"},
+	candidate{"pubkey", "Print your public key for sharing with teammates"},
+)
+
+// completeSecretArgs completes the encrypted variables for decrypt and the
+// config files for rekey.
+func completeSecretArgs(prev []string) []candidate {
+	switch prev[0] {
+	case "decrypt":
+		cfg, _ := completionConfig()
+		if cfg == nil || len(prev) > 1 {
+			return nil
+		}
+		var candidates []candidate
+		for _, name := range sortedKeys(cfg.Sources) {
+			if cfg.Sources[name].Encrypted != "" {
+				candidates = append(candidates, candidate{word: name})
+			}
+		}
+		return candidates
+	case "rekey":
+		return completeFiles
+	}
+	return nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -40,12 +40,14 @@ func doctorCommand() error {
 	results := []DiagnosticResult{}
 
 	// Check shell detection
-	shellType := shell.Detect()
+	detection := shell.Inspect()
+	shellType := detection.Shell()
 	if shellType == shell.Unknown {
 		results = append(results, DiagnosticResult{"✗", "Shell detection failed - unknown shell"})
 	} else {
 		results = append(results, DiagnosticResult{"✓", fmt.Sprintf("Shell detected: %s", shellType)})
 	}
+	results = append(results, checkShellDetection(detection)...)
 
 	// Check for config file
 	cwd, err := os.Getwd()
@@ -74,14 +76,45 @@ func doctorCommand() error {
 			} else {
 				results = append(results, DiagnosticResult{"✓", "Config syntax is valid"})
 			}
+
+			// Check that sources evaluate, as they will on apply
+			if err := config.ResolveSources(cfg, filepath.Dir(configPath)); err != nil {
+				for _, line := range strings.Split(err.Error(), "\n") {
+					results = append(results, DiagnosticResult{"✗", fmt.Sprintf("Source failed: %s", line)})
+				}
+			} else if len(cfg.Sources) > 0 {
+				results = append(results, DiagnosticResult{"✓", "Value sources evaluate"})
+			}
+
+			// Check for config entries shadowed by built-in variables
+			for key := range cfg.Environment {
+				if env.IsBuiltin(key) {
+					results = append(results, DiagnosticResult{"⚠", fmt.Sprintf("%s is a built-in variable; the config value is ignored", key)})
+				}
+			}
+
+			// Check variable references
+			warnings, err := env.CheckExpansion(cfg, filepath.Dir(configPath))
+			if err != nil {
+				results = append(results, DiagnosticResult{"✗", fmt.Sprintf("Expansion failed: %v", err)})
+			}
+			for _, warning := range warnings {
+				results = append(results, DiagnosticResult{"⚠", warning})
+			}
 		}
 	}
 
 	// Check auto-apply status
-	if shell.IsAutoApplyEnabled() {
-		results = append(results, DiagnosticResult{"✓", "Auto-apply is enabled"})
+	if settings, err := config.LoadSettings(); err != nil {
+		results = append(results, DiagnosticResult{"✗", fmt.Sprintf("Failed to load settings: %v", err)})
 	} else {
-		results = append(results, DiagnosticResult{"ℹ", "Auto-apply is disabled"})
+		cfg, _, _ := config.FindConfig(cwd)
+		decision := env.DecideAutoApply(cwd, cfg, settings)
+		if decision.Enabled {
+			results = append(results, DiagnosticResult{"✓", fmt.Sprintf("Auto-apply is enabled (%s)", decision.Source)})
+		} else {
+			results = append(results, DiagnosticResult{"ℹ", fmt.Sprintf("Auto-apply is disabled (%s)", decision.Source)})
+		}
 	}
 
 	// Check shell integration
@@ -89,12 +122,7 @@ func doctorCommand() error {
 	if shellConfigFile == "" {
 		results = append(results, DiagnosticResult{"⚠", "Unable to determine shell config file"})
 	} else {
-		if checkShellIntegration(shellConfigFile) {
-			results = append(results, DiagnosticResult{"✓", "Shell integration appears to be installed"})
-		} else {
-			results = append(results, DiagnosticResult{"⚠", fmt.Sprintf("Shell integration not found in %s", shellConfigFile)})
-			results = append(results, DiagnosticResult{"ℹ", "Run: direnv init >> " + shellConfigFile})
-		}
+		results = append(results, checkInstalledBlock(shellType, shellConfigFile)...)
 	}
 
 	// Check environment state
@@ -186,9 +214,92 @@ func checkShellIntegration(configFile string) bool {
 	if err != nil {
 		return false
 	}
+	return hasIntegrationCode(string(content))
+}
+
+// hasIntegrationCode reports whether content looks like it loads direnv,
+// with or without the markers of direnv install.
+func hasIntegrationCode(content string) bool {
+	return strings.Contains(content, "_direnv_check") ||
+		strings.Contains(content, "_direnv_hook") ||
+		strings.Contains(content, "direnv init") ||
+		strings.Contains(content, "direnv hook") ||
+		strings.Contains(content, "DIRENV_SHELL") ||
+		strings.Contains(content, "direnv.nu")
+}
+
+// checkShellDetection reports the sources of the shell and where they
+// disagree.
+func checkShellDetection(d shell.Detection) []DiagnosticResult {
+	var results []DiagnosticResult
+	if d.Override != "" {
+		results = append(results, DiagnosticResult{"ℹ", fmt.Sprintf("Shell set with --shell: %s", d.Override)})
+	}
+	if d.Parent != shell.Unknown {
+		results = append(results, DiagnosticResult{"ℹ", fmt.Sprintf("Parent process: %s (%s)", d.Parent, d.ParentPath)})
+	} else {
+		results = append(results, DiagnosticResult{"ℹ", "Parent process: no shell found"})
+	}
+	integration := string(d.Integration)
+	if d.Integration == shell.Unknown {
+		integration = "unset"
+	}
+	results = append(results, DiagnosticResult{"ℹ", fmt.Sprintf("DIRENV_SHELL: %s, $SHELL: %s", integration, d.Login)})
 
-	contentStr := string(content)
-	return strings.Contains(contentStr, "_direnv_check") ||
-		strings.Contains(contentStr, "direnv init") ||
-		strings.Contains(contentStr, "DIRENV_SHELL")
+	if d.Parent == shell.Unknown {
+		return results
+	}
+	if d.Integration != shell.Unknown && d.Integration != d.Parent {
+		results = append(results, DiagnosticResult{"⚠", fmt.Sprintf("DIRENV_SHELL is %s but direnv runs under %s; the %s integration may not be loaded", d.Integration, d.Parent, d.Parent)})
+	}
+	if d.Login != d.Parent {
+		results = append(results, DiagnosticResult{"ℹ", fmt.Sprintf("Login shell ($SHELL) is %s, but %s is running", d.Login, d.Parent)})
+	}
+	return results
+}
+
+// checkInstalledBlock compares the integration block in configFile with
+// the one this binary would install.
+func checkInstalledBlock(shellType shell.ShellType, configFile string) []DiagnosticResult {
+	content, _ := os.ReadFile(configFile)
+	block := shell.ParseBlock(string(content))
+	if block == nil {
+		if checkShellIntegration(configFile) {
+			return []DiagnosticResult{
+				{"✓", "Shell integration appears to be installed"},
+				{"ℹ", "Run 'direnv install' to manage it in a marked block that can be updated"},
+			}
+		}
+		return []DiagnosticResult{
+			{"⚠", fmt.Sprintf("Shell integration not found in %s", configFile)},
+			{"ℹ", "Run: " + installHint(shellType, configFile)},
+		}
+	}
+
+	var results []DiagnosticResult
+	expected, err := integrationBlock(shellType)
+	switch {
+	case err != nil:
+		results = append(results, DiagnosticResult{"✗", fmt.Sprintf("Failed to generate shell integration: %v", err)})
+	case block.Modified:
+		results = append(results, DiagnosticResult{"⚠", fmt.Sprintf("The direnv block in %s was edited; 'direnv install' replaces it", configFile)})
+	case block.Hash != shell.ParseBlock(expected).Hash:
+		results = append(results, DiagnosticResult{"⚠", fmt.Sprintf("Shell integration in %s is outdated (installed by direnv %s, running %s)", configFile, block.Version, version())})
+		results = append(results, DiagnosticResult{"ℹ", "Run: direnv install --shell " + string(shellType)})
+	default:
+		results = append(results, DiagnosticResult{"✓", fmt.Sprintf("Shell integration is up to date (installed by direnv %s)", block.Version)})
+	}
+	if hasIntegrationCode(shell.WithoutBlocks(string(content))) {
+		results = append(results, DiagnosticResult{"⚠", fmt.Sprintf("%s also loads direnv outside the marked block", configFile)})
+	}
+	return results
+}
+
+// installHint tells how to add the init script to the shell's config file.
+func installHint(shellType shell.ShellType, configFile string) string {
+	hint := "direnv install --shell " + string(shellType)
+	if shellType == shell.Posix && os.Getenv("ENV") == "" {
+		hint += fmt.Sprintf(", then add 'ENV=%s; export ENV' to ~/.profile", configFile)
+	}
+	return hint
 }
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/env"
+	"github.com/TierOne-Software/direnv/shell"
+)
+
+// exportCommand is run by the shell integration before every prompt. It
+// finds the config for the current directory and prints the code that
+// applies it, unloads the environment that was left, or nothing if the
+// applied environment is still current. It must be fast when nothing
+// changed, so that path only parses the config files.
+func exportCommand(args []string) error {
+	shellType := shell.Detect()
+	if len(args) > 0 {
+		shellType = shell.ShellType(args[0])
+	}
+	dialect, ok := shell.Lookup(shellType)
+	if !ok {
+		return shell.UnsupportedError(shellType)
+	}
+	if err := env.InheritSession(); err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+
+	script, err := exportScript(dialect)
+	if err != nil {
+		return err
+	}
+	if script == "" {
+		// Nothing changed, but a new shell learns its session. Shells that
+		// load a document still need an empty one.
+		if script, err = shell.Finish(dialect, env.ExportSession(dialect)); err != nil {
+			return err
+		}
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// exportScript returns the finished code for the shell, or "" if there's
+// nothing to do.
+func exportScript(dialect shell.Dialect) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	previous, err := env.LoadSavedState()
+	if err != nil {
+		return "", fmt.Errorf("failed to load previous state: %w", err)
+	}
+	active := previous != nil && previous.Directory != ""
+
+	restored, err := env.RestoredInSession()
+	if err != nil {
+		return "", err
+	}
+
+	configPath := config.FindConfigPath(cwd)
+	if restored != "" && (configPath == "" || filepath.Dir(configPath) != restored) {
+		// Left the project restored by hand; it applies again next time
+		if err := env.RecordRestored(""); err != nil {
+			return "", err
+		}
+		restored = ""
+	}
+	if configPath == "" {
+		// Left the project. A manual apply stays until direnv restore.
+		if !active || !previous.AutoApplied {
+			return "", nil
+		}
+		return restoreEnvironment(dialect)
+	}
+
+	// Sources aren't resolved for the comparison; the hash ignores them
+	cfg, err := config.LoadProjectConfig(configPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	configDir := filepath.Dir(configPath)
+	if active && previous.Directory == configDir && previous.ConfigHash == env.ConfigHash(cfg) {
+		return "", nil
+	}
+	if restored == configDir {
+		return "", nil // until direnv apply
+	}
+
+	settings, err := config.LoadSettings()
+	if err != nil {
+		return "", err
+	}
+	if !env.DecideAutoApply(cwd, cfg, settings).Enabled {
+		// Don't leave another project's auto-applied environment behind
+		if active && previous.AutoApplied && previous.Directory != configDir {
+			return restoreEnvironment(dialect)
+		}
+		return "", nil
+	}
+
+	if err := config.ResolveSources(cfg, configDir); err != nil {
+		return "", fmt.Errorf("failed to resolve sources: %w", err)
+	}
+	return applyEnvironment(cfg, configPath, cwd, dialect, true)
+}
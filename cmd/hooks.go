@@ -0,0 +1,103 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/env"
+)
+
+const hooksUsage = `usage: direnv hooks <command>
+
+Commands:
+  status  - Show on_change hooks and the fingerprints they last ran with`
+
+func hooksCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("%s", hooksUsage)
+	}
+
+	switch args[0] {
+	case "status":
+		return hooksStatusCommand()
+	default:
+		return fmt.Errorf("unknown hooks command: %s\n\n%s", args[0], hooksUsage)
+	}
+}
+
+func hooksStatusCommand() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	cfg, configPath, err := config.FindConfig(cwd)
+	if err != nil {
+		return fmt.Errorf("failed to find config: %w", err)
+	}
+	if cfg == nil {
+		return fmt.Errorf("no .direnv.toml found in current or parent directories")
+	}
+
+	if len(cfg.Hooks.OnChange) == 0 {
+		fmt.Println("No on_change hooks configured")
+		return nil
+	}
+
+	statuses, err := env.ChangeHookStatus(cfg, filepath.Dir(configPath))
+	if err != nil {
+		return err
+	}
+
+	for i, status := range statuses {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s\n", status.Hook.Run)
+		fmt.Printf("  Files:       %s\n", strings.Join(status.Hook.Files, ", "))
+		fmt.Printf("  Fingerprint: %s\n", shortHash(status.Fingerprint))
+		if status.Record == nil {
+			fmt.Println("  Last run:    never")
+		} else {
+			fmt.Printf("  Last run:    %s (fingerprint %s)\n", status.Record.LastRun.Format(time.RFC3339), shortHash(status.Record.Fingerprint))
+		}
+		switch {
+		case status.Running:
+			fmt.Println("  Status:      running in the background")
+		case status.Record == nil:
+			fmt.Println("  Status:      pending")
+		case status.Pending():
+			fmt.Println("  Status:      pending (files changed)")
+		default:
+			fmt.Println("  Status:      up to date")
+		}
+	}
+	return nil
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/TierOne-Software/direnv/shell"
+)
+
+// integrationTarget returns the config file the integration for args'
+// shell goes into.
+func integrationTarget(args []string, usage string) (shell.ShellType, string, error) {
+	if len(args) > 0 {
+		return "", "", fmt.Errorf("usage: %s", usage)
+	}
+	shellType := shell.Detect()
+	if !shellType.IsSupported() {
+		return "", "", fmt.Errorf("unsupported shell: %s (use --shell)", shellType)
+	}
+	configFile := shell.GetConfigFile(shellType)
+	if configFile == "" {
+		return "", "", fmt.Errorf("unable to determine the config file of %s", shellType)
+	}
+	return shellType, configFile, nil
+}
+
+// integrationBlock returns the block direnv install writes for shellType.
+func integrationBlock(shellType shell.ShellType) (string, error) {
+	script, err := shell.GetHookScript(shellType)
+	if err != nil {
+		return "", err
+	}
+	return shell.FormatBlock(script, version()), nil
+}
+
+func installCommand(args []string) error {
+	shellType, configFile, err := integrationTarget(args, "direnv install [--shell <shell>]")
+	if err != nil {
+		return err
+	}
+	block, err := integrationBlock(shellType)
+	if err != nil {
+		return err
+	}
+
+	content, _ := os.ReadFile(configFile)
+	installed := shell.ParseBlock(string(content)) != nil
+	backup, err := shell.InstallBlock(configFile, block)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case installed && backup == "":
+		fmt.Printf("direnv integration in %s is up to date\n", configFile)
+		return nil
+	case installed:
+		fmt.Printf("Updated direnv integration in %s\n", configFile)
+	default:
+		fmt.Printf("Installed direnv integration in %s\n", configFile)
+	}
+	if backup != "" {
+		fmt.Printf("Backup: %s\n", backup)
+	}
+
+	if hasIntegrationCode(shell.WithoutBlocks(string(content))) {
+		fmt.Fprintf(os.Stderr, "Warning: %s also has direnv code outside the marked block; remove it to avoid loading direnv twice\n", configFile)
+	}
+	if shellType == shell.Posix && os.Getenv("ENV") == "" {
+		fmt.Printf("Add 'ENV=%s; export ENV' to ~/.profile so sh reads it\n", configFile)
+	}
+	fmt.Println("Restart your shell to load it")
+	return nil
+}
+
+func uninstallCommand(args []string) error {
+	_, configFile, err := integrationTarget(args, "direnv uninstall [--shell <shell>]")
+	if err != nil {
+		return err
+	}
+	backup, err := shell.UninstallBlock(configFile)
+	if err != nil {
+		return err
+	}
+	if backup == "" {
+		fmt.Printf("No direnv integration block in %s\n", configFile)
+		return nil
+	}
+	fmt.Printf("Removed direnv integration from %s\n", configFile)
+	fmt.Printf("Backup: %s\n", backup)
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TierOne-Software/direnv/env"
+)
+
+// promptBudget is how long direnv prompt may take. A prompt that waits
+// longer is worse than one without the segment.
+const promptBudget = 50 * time.Millisecond
+
+const promptUsage = "usage: direnv prompt [--format <format>] [--json]"
+
+// promptCommand prints a prompt segment for the environment applied in this
+// session. It never fails the prompt: if the status can't be read within
+// the budget, it prints nothing, or with --json the inactive status.
+func promptCommand(args []string) error {
+	format := ""
+	asJSON := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--json":
+			asJSON = true
+		case arg == "--format" && i+1 < len(args):
+			i++
+			format = args[i]
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		default:
+			return errors.New(promptUsage)
+		}
+	}
+
+	result := make(chan *env.PromptStatus, 1)
+	go func() {
+		status, err := env.LoadPromptStatus()
+		if err != nil {
+			status = nil
+		}
+		result <- status
+	}()
+
+	var status *env.PromptStatus
+	select {
+	case status = <-result:
+	case <-time.After(promptBudget):
+	}
+	if status == nil {
+		if !asJSON {
+			return nil
+		}
+		// Frameworks parse every prompt's output
+		status = env.InactivePromptStatus()
+	}
+
+	if asJSON {
+		data, err := json.Marshal(status)
+		if err != nil {
+			return fmt.Errorf("failed to encode status: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Print(status.Format(format))
+	return nil
+}
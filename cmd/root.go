@@ -28,44 +28,69 @@ import (
 )
 
 func Execute() error {
+	args, err := extractShellFlag(os.Args[1:])
+	if err != nil {
+		return err
+	}
+	os.Args = append(os.Args[:1], args...)
+
 	if len(os.Args) < 2 {
-		return fmt.Errorf("usage: direnv <command> [args]\n\nCommands:\n  apply     - Apply directory environment\n  diff      - Show what would change\n  info      - Show current status\n  enable    - Enable auto-apply\n  disable   - Disable auto-apply\n  init      - Initialize shell integration\n  completion - Generate shell completion\n  doctor    - Diagnose configuration issues\n  cleanup   - Clean up orphaned state files\n  restore   - Restore previous environment\n  run       - Run a script from the config with optional arguments")
-	}
-
-	command := os.Args[1]
-
-	switch command {
-	case "apply":
-		return applyCommand()
-	case "diff":
-		return diffCommand()
-	case "info":
-		return infoCommand()
-	case "enable":
-		return enableCommand()
-	case "disable":
-		return disableCommand()
-	case "init":
-		return initCommand()
-	case "completion":
-		return completionCommand()
-	case "doctor":
-		return doctorCommand()
-	case "cleanup":
-		return cleanupCommand()
-	case "restore":
-		return restoreCommand()
-	case "run":
-		if len(os.Args) < 3 {
-			return fmt.Errorf("usage: direnv run <script-name> [args...]")
+		return fmt.Errorf("%s", usage())
+	}
+
+	c := lookupCommand(os.Args[1])
+	if c == nil {
+		return fmt.Errorf("unknown command: %s", os.Args[1])
+	}
+	return c.run(os.Args[2:])
+}
+
+// extractShellFlag removes --shell X or --shell=X from args, which may
+// appear before or after the command, and makes it override detection.
+// The arguments of a script passed to direnv run are left alone.
+func extractShellFlag(args []string) ([]string, error) {
+	var rest []string
+	positional := 0
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(rest) > 0 && rest[0] == completeCommand {
+			return append(rest, args[i:]...), nil
+		}
+		if len(rest) > 0 && positional >= 2 {
+			if c := lookupCommand(rest[0]); c != nil && c.passArgs {
+				return append(rest, args[i:]...), nil
+			}
+		}
+		switch {
+		case arg == "--shell" || strings.HasPrefix(arg, "--shell="):
+			var name string
+			if value, ok := strings.CutPrefix(arg, "--shell="); ok {
+				name = value
+			} else if i+1 < len(args) {
+				i++
+				name = args[i]
+			}
+			if name == "" {
+				return nil, fmt.Errorf("--shell requires a shell name")
+			}
+			if err := shell.SetOverride(shell.ShellType(name)); err != nil {
+				return nil, err
+			}
+		default:
+			if !strings.HasPrefix(arg, "-") {
+				positional++
+			}
+			rest = append(rest, arg)
 		}
-		return runScriptCommand(os.Args[2], os.Args[3:])
-	default:
-		return fmt.Errorf("unknown command: %s", command)
 	}
+	return rest, nil
 }
 
 func applyCommand() error {
+	if err := env.InheritSession(); err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+
 	cwd, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("failed to get current directory: %w", err)
@@ -78,30 +103,161 @@ func applyCommand() error {
 	if cfg == nil {
 		return fmt.Errorf("no .direnv.toml found in current or parent directories")
 	}
+	if err := config.ResolveSources(cfg, filepath.Dir(configPath)); err != nil {
+		return fmt.Errorf("failed to resolve sources: %w", err)
+	}
+
+	script, err := applyEnvironment(cfg, configPath, cwd, shell.DialectFor(shell.Detect()), false)
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}
 
+// applyEnvironment runs the apply of cfg for cwd and returns the shell code
+// that unloads the previous environment and exports the new one. auto is
+// set when the prompt hook applies it.
+func applyEnvironment(cfg *config.Config, configPath, cwd string, dialect shell.Dialect, auto bool) (string, error) {
 	configDir := filepath.Dir(configPath)
 
-	// Execute on-leave hook from previous environment if it exists
-	if err := env.ExecuteOnLeaveHook(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: on-leave hook failed: %v\n", err)
+	// Undo a previously applied environment first, so stale variables are
+	// removed and values expand against the original environment
+	previous, err := env.LoadSavedState()
+	if err != nil {
+		return "", fmt.Errorf("failed to load previous state: %w", err)
+	}
+	var unload string
+	if previous != nil {
+		unload = env.UnloadForShell(previous, dialect)
+		if err := env.RevertApplied(previous); err != nil {
+			return "", fmt.Errorf("failed to revert previous environment: %w", err)
+		}
+	}
+
+	// Leave the previous project before any hook of this one runs. A
+	// re-apply of the same project doesn't leave it or stop its jobs.
+	if previous != nil && previous.Directory != configDir {
+		if err := env.ExecuteOnLeaveHook(); err != nil {
+			if env.IsAbort(err) {
+				return "", fmt.Errorf("environment not applied: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	configHash := env.ConfigHash(cfg)
+	entered, err := env.EnteredInSession(configDir)
+	if err != nil {
+		return "", err
+	}
+
+	// A failing pre_apply hook aborts before anything is emitted
+	if err := runApplyHook(cfg, env.HookPreApply, configDir); err != nil {
+		return "", err
+	}
+	if !entered {
+		if err := runApplyHook(cfg, env.HookOnEnter, configDir); err != nil {
+			return "", err
+		}
+	}
+	if cwd != configDir {
+		if err := runApplyHook(cfg, env.HookOnEnterSubdir, configDir); err != nil {
+			return "", err
+		}
+	}
+	if previous != nil && previous.Directory == configDir && previous.ConfigHash != "" && previous.ConfigHash != configHash {
+		if err := runApplyHook(cfg, env.HookOnConfigChange, configDir); err != nil {
+			return "", err
+		}
+	}
+
+	if err := env.RunChangeHooks(cfg, configDir); err != nil {
+		if env.IsAbort(err) {
+			return "", fmt.Errorf("environment not applied: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	// Build the output first so a failure (e.g. an undecryptable secret)
+	// leaves the previous environment and its state untouched
+	output, err := env.ExportForShell(cfg, configDir, dialect)
+	if err != nil {
+		return "", fmt.Errorf("failed to export environment: %w", err)
+	}
+
+	hookValues, err := env.RunConfigHook(cfg, env.HookPostApply, configDir)
+	if err != nil {
+		if env.IsAbort(err) {
+			return "", fmt.Errorf("environment not applied: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if len(hookValues) > 0 {
+		env.MergeHookValues(cfg, env.HookPostApply, hookValues)
+		output += "\n" + env.ExportVariables(hookValues, dialect)
 	}
 
 	// Save current state before applying new environment
 	state, err := env.GetCurrentState()
 	if err != nil {
-		return fmt.Errorf("failed to get current state: %w", err)
+		return "", fmt.Errorf("failed to get current state: %w", err)
 	}
 
-	if err := env.SaveStateWithHook(state, configDir, cfg.Hooks.OnLeave); err != nil {
-		return fmt.Errorf("failed to save current state: %w", err)
+	onLeave := cfg.Hooks.OnLeave
+	onLeave.Run, err = env.ExpandHook(cfg, onLeave.Run, configDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand on_leave hook: %w", err)
 	}
 
-	shellType := shell.Detect()
+	env.RecordApplied(state, cfg, configDir)
+	// Compared with the config before hooks run, by direnv export and
+	// the next apply
+	state.ConfigHash = configHash
+	state.AutoApplied = auto
+	if state.Jobs, err = env.RunningJobs(configDir); err != nil {
+		return "", err
+	}
+	if err := env.SaveStateWithHook(state, configDir, onLeave); err != nil {
+		return "", fmt.Errorf("failed to save current state: %w", err)
+	}
+	if err := env.RecordEntered(configDir); err != nil {
+		return "", err
+	}
+	if err := env.RecordRestored(""); err != nil {
+		return "", err
+	}
+
+	// Services keep running while any shell has their project loaded
+	if previous != nil && previous.Directory != "" && previous.Directory != configDir {
+		if err := env.LeaveProject(previous.Directory); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	started, err := env.EnterProject(cfg, configDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	for _, name := range started {
+		fmt.Fprintf(os.Stderr, "direnv: started service %s\n", name)
+	}
 
 	// Output shell commands for evaluation
-	output := env.ExportForShell(cfg, configDir, string(shellType))
-	fmt.Print(output)
+	return shell.Finish(dialect, unload+output+"\n"+env.ExportSession(dialect))
+}
 
+// runApplyHook runs a hook that precedes the export and merges the
+// variables it sets into cfg. It returns an error only if the apply must
+// be aborted.
+func runApplyHook(cfg *config.Config, name, configDir string) error {
+	values, err := env.RunConfigHook(cfg, name, configDir)
+	if err != nil {
+		if env.IsAbort(err) {
+			return fmt.Errorf("environment not applied: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	env.MergeHookValues(cfg, name, values)
 	return nil
 }
 
@@ -122,6 +278,11 @@ func diffCommand() error {
 
 	configDir := filepath.Dir(configPath)
 
+	// Hooks aren't run for a diff; show what they set on the last apply
+	if state, err := env.LoadSavedState(); err == nil && state != nil && state.Directory == configDir {
+		env.MergeSavedHookValues(cfg, state)
+	}
+
 	diff, err := env.GenerateDiff(cfg, configDir)
 	if err != nil {
 		return fmt.Errorf("failed to generate diff: %w", err)
@@ -158,24 +319,34 @@ func infoCommand() error {
 
 		// Show config summary
 		if cfg != nil {
-			envCount := len(cfg.Environment)
+			envCount := len(cfg.Environment) + len(cfg.Sources)
 			aliasCount := len(cfg.Aliases)
 			scriptCount := len(cfg.Scripts)
 			fmt.Printf("Environment: %d variables, %d aliases, %d scripts\n", envCount, aliasCount, scriptCount)
 
-			if cfg.Hooks.PreApply != "" || cfg.Hooks.PostApply != "" || cfg.Hooks.OnLeave != "" {
-				fmt.Printf("Hooks: ")
-				hooks := []string{}
-				if cfg.Hooks.PreApply != "" {
-					hooks = append(hooks, "pre-apply")
-				}
-				if cfg.Hooks.PostApply != "" {
-					hooks = append(hooks, "post-apply")
+			hooks := []string{}
+			for _, hook := range []struct {
+				name string
+				hook config.Hook
+			}{
+				{"pre-apply", cfg.Hooks.PreApply},
+				{"post-apply", cfg.Hooks.PostApply},
+				{"on-leave", cfg.Hooks.OnLeave},
+				{"on-enter", cfg.Hooks.OnEnter},
+				{"on-enter-subdir", cfg.Hooks.OnEnterSubdir},
+				{"on-config-change", cfg.Hooks.OnConfigChange},
+				{"pre-run", cfg.Hooks.PreRun},
+				{"post-run", cfg.Hooks.PostRun},
+			} {
+				if hook.hook.IsSet() {
+					hooks = append(hooks, hook.name)
 				}
-				if cfg.Hooks.OnLeave != "" {
-					hooks = append(hooks, "on-leave")
-				}
-				fmt.Printf("%s\n", strings.Join(hooks, ", "))
+			}
+			if len(cfg.Hooks.OnChange) > 0 {
+				hooks = append(hooks, fmt.Sprintf("on-change (%d)", len(cfg.Hooks.OnChange)))
+			}
+			if len(hooks) > 0 {
+				fmt.Printf("Hooks: %s\n", strings.Join(hooks, ", "))
 			}
 		}
 	} else {
@@ -193,78 +364,146 @@ func infoCommand() error {
 			}
 
 			state, err := env.LoadSavedState()
-			if err == nil && state != nil && state.OnLeaveHook != "" {
+			if err == nil && state != nil && state.OnLeave.IsSet() {
 				fmt.Println("On-leave hook: configured")
 			}
 		} else {
 			fmt.Println("State: environment modified")
 		}
-		fmt.Printf("State file: ~/.direnv_state_%d.json\n", os.Getpid())
+		fmt.Printf("State file: %s\n", env.StateFile())
 	} else {
 		fmt.Println("State: clean")
 	}
 
-	// Auto-apply status
-	if shell.IsAutoApplyEnabled() {
-		fmt.Println("Auto-apply: enabled")
+	id, parent := env.SessionInfo()
+	if parent != "" {
+		fmt.Printf("Session: %s (inherited from %s)\n", id, parent)
 	} else {
-		fmt.Println("Auto-apply: disabled")
+		fmt.Printf("Session: %s\n", id)
 	}
 
-	return nil
-}
-
-func enableCommand() error {
-	return shell.SetAutoApply(true)
-}
+	// Auto-apply status and the choice that decided it
+	settings, err := config.LoadSettings()
+	if err != nil {
+		return err
+	}
+	decision := env.DecideAutoApply(cwd, cfg, settings)
+	if decision.Enabled {
+		fmt.Printf("Auto-apply: enabled (%s)\n", decision.Source)
+	} else {
+		fmt.Printf("Auto-apply: disabled (%s)\n", decision.Source)
+	}
 
-func disableCommand() error {
-	return shell.SetAutoApply(false)
+	return nil
 }
 
-func initCommand() error {
+func initCommand(args []string) error {
 	shellType := shell.Detect()
+	if len(args) > 0 {
+		shellType = shell.ShellType(args[0])
+	}
+	if !shellType.IsSupported() {
+		return shell.UnsupportedError(shellType)
+	}
 	script := shell.GetInitScript(shellType)
 	fmt.Print(script)
 	return nil
 }
 
-func completionCommand() error {
-	if len(os.Args) >= 3 && os.Args[2] == "scripts" {
-		// Special case: list available scripts for completion
-		cwd, err := os.Getwd()
-		if err != nil {
-			return err
-		}
-
-		cfg, _, err := config.FindConfig(cwd)
-		if err != nil || cfg == nil {
-			return nil // No error, just no scripts
-		}
+func hookCommand(args []string) error {
+	shellType := shell.Detect()
+	if len(args) > 0 {
+		shellType = shell.ShellType(args[0])
+	}
+	script, err := shell.GetHookScript(shellType)
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}
 
-		for name := range cfg.Scripts {
-			fmt.Println(name)
+func completionCommand(args []string) error {
+	if len(args) > 0 && args[0] == "scripts" {
+		// List available scripts, for completion scripts of older versions
+		cfg, _ := completionConfig()
+		if cfg != nil {
+			for _, name := range sortedKeys(cfg.Scripts) {
+				fmt.Println(name)
+			}
 		}
 		return nil
 	}
 
 	shellType := shell.Detect()
+	if len(args) > 0 {
+		shellType = shell.ShellType(args[0])
+	}
+	if !shellType.IsSupported() {
+		return shell.UnsupportedError(shellType)
+	}
 	script := shell.GetCompletionScript(shellType)
 	fmt.Print(script)
 	return nil
 }
 
 func restoreCommand() error {
+	if err := env.InheritSession(); err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+
+	script, err := restoreEnvironment(shell.DialectFor(shell.Detect()))
+	if err != nil {
+		return err
+	}
+
+	// The prompt hook leaves the project restored until the shell leaves it
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	if configPath := config.FindConfigPath(cwd); configPath != "" {
+		if err := env.RecordRestored(filepath.Dir(configPath)); err != nil {
+			return err
+		}
+	}
+
+	// Output shell commands for evaluation; messages go to stderr
+	fmt.Print(script)
+	fmt.Fprintln(os.Stderr, "Environment restored")
+	return nil
+}
+
+// restoreEnvironment leaves the applied environment and returns the shell
+// code that unloads it.
+func restoreEnvironment(dialect shell.Dialect) (string, error) {
 	// Execute on-leave hook before restoring
 	if err := env.ExecuteOnLeaveHook(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: on-leave hook failed: %v\n", err)
+		if env.IsAbort(err) {
+			return "", fmt.Errorf("environment not restored: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	state, err := env.LoadSavedState()
+	if err != nil {
+		return "", fmt.Errorf("failed to load state: %w", err)
 	}
 
 	if err := env.RestoreState(); err != nil {
-		return fmt.Errorf("failed to restore state: %w", err)
+		return "", fmt.Errorf("failed to restore state: %w", err)
 	}
-	fmt.Println("Environment restored")
-	return nil
+	if state != nil && state.Directory != "" {
+		if err := env.LeaveProject(state.Directory); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	var unload string
+	if state != nil {
+		unload = env.UnloadForShell(state, dialect)
+	}
+	return shell.Finish(dialect, unload+"\n"+env.ExportSession(dialect))
 }
 
 func cleanupCommand() error {
@@ -289,11 +528,9 @@ func runScriptCommand(scriptName string, args []string) error {
 		return fmt.Errorf("no .direnv.toml found in current or parent directories")
 	}
 
-	script, exists := cfg.Scripts[scriptName]
-	if !exists {
-		return fmt.Errorf("script '%s' not found in config", scriptName)
-	}
-
 	configDir := filepath.Dir(configPath)
-	return env.ExecuteScript(scriptName, script, configDir, args...)
+	if err := config.ResolveSources(cfg, configDir); err != nil {
+		return fmt.Errorf("failed to resolve sources: %w", err)
+	}
+	return env.ExecuteConfigScript(cfg, scriptName, configDir, args...)
 }
@@ -0,0 +1,217 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"crypto/ecdh"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/env"
+)
+
+const secretUsage = `usage: direnv secret <command> [args]
+
+Commands:
+  encrypt [value]      - Encrypt a value (read from stdin if omitted)
+  decrypt <VAR|value>  - Decrypt a config variable or an encrypted value
+  rekey [file...]      - Re-encrypt all secrets in config files to the current recipients
+  pubkey               - Print your public key for sharing with teammates`
+
+func secretCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("%s", secretUsage)
+	}
+
+	switch args[0] {
+	case "encrypt":
+		return secretEncryptCommand(args[1:])
+	case "decrypt":
+		return secretDecryptCommand(args[1:])
+	case "rekey":
+		return secretRekeyCommand(args[1:])
+	case "pubkey":
+		return secretPubkeyCommand()
+	default:
+		return fmt.Errorf("unknown secret command: %s\n\n%s", args[0], secretUsage)
+	}
+}
+
+func secretEncryptCommand(args []string) error {
+	var plaintext string
+	if len(args) > 0 {
+		plaintext = strings.Join(args, " ")
+	} else {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read value from stdin: %w", err)
+		}
+		plaintext = strings.TrimSuffix(string(data), "\n")
+	}
+
+	// Make sure our own key exists so we can always decrypt what we encrypt
+	if _, err := env.LoadIdentity(); err != nil {
+		return err
+	}
+
+	recipients, err := env.LoadRecipients()
+	if err != nil {
+		return err
+	}
+
+	armored, err := env.EncryptSecret(plaintext, recipients)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	fmt.Printf("{ encrypted = %q }\n", armored)
+	return nil
+}
+
+func secretDecryptCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: direnv secret decrypt <VAR|value>")
+	}
+
+	armored := args[0]
+	if !strings.HasPrefix(armored, "direnv-secret:") {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+		cfg, _, err := config.FindConfig(cwd)
+		if err != nil {
+			return fmt.Errorf("failed to find config: %w", err)
+		}
+		if cfg == nil {
+			return fmt.Errorf("no .direnv.toml found in current or parent directories")
+		}
+		src, exists := cfg.Sources[armored]
+		if !exists || src.Encrypted == "" {
+			return fmt.Errorf("variable '%s' is not an encrypted value in config", armored)
+		}
+		armored = src.Encrypted
+	}
+
+	identity, err := env.ReadIdentity()
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := env.DecryptSecret(armored, identity)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	fmt.Println(plaintext)
+	return nil
+}
+
+func secretRekeyCommand(args []string) error {
+	files := args
+	if len(files) == 0 {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+		_, configPath, err := config.FindConfig(cwd)
+		if err != nil {
+			return fmt.Errorf("failed to find config: %w", err)
+		}
+		if configPath == "" {
+			return fmt.Errorf("no .direnv.toml found in current or parent directories")
+		}
+		files = append(files, configPath)
+		localConfigPath := filepath.Join(filepath.Dir(configPath), config.LocalConfigFileName)
+		if _, err := os.Stat(localConfigPath); err == nil {
+			files = append(files, localConfigPath)
+		}
+	}
+
+	identity, err := env.ReadIdentity()
+	if err != nil {
+		return err
+	}
+	recipients, err := env.LoadRecipients()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		count, err := rekeyFile(file, identity, recipients)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: re-encrypted %d secret(s) for %d recipient(s)\n", file, count, len(recipients))
+	}
+
+	return nil
+}
+
+// rekeyFile replaces each ciphertext in place so comments and layout of the
+// config file are preserved.
+func rekeyFile(path string, identity *ecdh.PrivateKey, recipients []*ecdh.PublicKey) (int, error) {
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	content := string(data)
+
+	count := 0
+	for key, src := range cfg.Sources {
+		if src.Encrypted == "" {
+			continue
+		}
+		rekeyed, err := env.RekeySecret(src.Encrypted, identity, recipients)
+		if err != nil {
+			return 0, fmt.Errorf("%s: failed to rekey %s: %w", path, key, err)
+		}
+		content = strings.ReplaceAll(content, src.Encrypted, rekeyed)
+		count++
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+	if err := os.WriteFile(path, []byte(content), info.Mode().Perm()); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return count, nil
+}
+
+func secretPubkeyCommand() error {
+	identity, err := env.LoadIdentity()
+	if err != nil {
+		return err
+	}
+	fmt.Println(env.FormatPublicKey(identity.PublicKey()))
+	return nil
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/env"
+)
+
+// loadProject finds the config for the current directory, like apply.
+func loadProject() (*config.Config, string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	cfg, configPath, err := config.FindConfig(cwd)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find config: %w", err)
+	}
+	if cfg == nil {
+		return nil, "", fmt.Errorf("no .direnv.toml found in current or parent directories")
+	}
+	return cfg, filepath.Dir(configPath), nil
+}
+
+// serviceNames returns the services named in args, or all of them.
+func serviceNames(cfg *config.Config, args []string) ([]string, error) {
+	if len(args) > 0 {
+		for _, name := range args {
+			if _, ok := cfg.Services[name]; !ok {
+				return nil, fmt.Errorf("service '%s' not found in config", name)
+			}
+		}
+		return args, nil
+	}
+
+	if len(cfg.Services) == 0 {
+		return nil, fmt.Errorf("no services configured")
+	}
+	names := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func upCommand(args []string) error {
+	cfg, project, err := loadProject()
+	if err != nil {
+		return err
+	}
+	if err := config.ResolveSources(cfg, project); err != nil {
+		return fmt.Errorf("failed to resolve sources: %w", err)
+	}
+	names, err := serviceNames(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, name := range names {
+		started, err := env.StartService(cfg, project, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := env.WaitReady(cfg, project, name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if started {
+			fmt.Printf("Started %s\n", name)
+		} else {
+			fmt.Printf("%s is already running\n", name)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func downCommand(args []string) error {
+	cfg, project, err := loadProject()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		// Also stops services that were removed from the config
+		if err := env.StopProjectServices(project); err != nil {
+			return err
+		}
+		fmt.Println("Stopped all services")
+		return nil
+	}
+	names, err := serviceNames(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, name := range names {
+		stopped, err := env.StopService(project, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if stopped {
+			fmt.Printf("Stopped %s\n", name)
+		} else {
+			fmt.Printf("%s is not running\n", name)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func psCommand() error {
+	cfg, project, err := loadProject()
+	if err != nil {
+		return err
+	}
+	if len(cfg.Services) == 0 {
+		fmt.Println("No services configured")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tSTATUS\tPID\tREADY\tRESTARTS\tSTARTED")
+	for _, state := range env.ServiceStates(cfg, project) {
+		pid, started, ready := "-", "-", "-"
+		if state.Record != nil {
+			started = state.Record.Started.Format(time.DateTime)
+			if state.Running {
+				pid = fmt.Sprint(state.Record.PID)
+			}
+		}
+		if state.Running && state.Service.Ready.TCP != "" {
+			ready = "no"
+			if state.Ready {
+				ready = "yes"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", state.Name, state.Status(), pid, ready, state.Restarts, started)
+	}
+	return w.Flush()
+}
+
+func logsCommand(args []string) error {
+	follow := false
+	var name string
+	for _, arg := range args {
+		switch {
+		case arg == "-f" || arg == "--follow":
+			follow = true
+		case name == "":
+			name = arg
+		default:
+			return fmt.Errorf("usage: direnv logs [-f] <service>")
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("usage: direnv logs [-f] <service>")
+	}
+
+	cfg, project, err := loadProject()
+	if err != nil {
+		return err
+	}
+	if _, err := serviceNames(cfg, []string{name}); err != nil {
+		return err
+	}
+
+	f, err := os.Open(env.ServiceLogFile(project, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no logs for %s; it has not been started", name)
+		}
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(os.Stdout, f); err != nil {
+		return err
+	}
+	if !follow {
+		return nil
+	}
+
+	// Poll for appended output until interrupted
+	for {
+		time.Sleep(200 * time.Millisecond)
+		if _, err := io.Copy(os.Stdout, f); err != nil {
+			return err
+		}
+	}
+}
@@ -25,17 +25,44 @@ import (
 )
 
 type Config struct {
-	AutoApply   bool              `toml:"auto_apply"`
-	Environment map[string]string `toml:"environment"`
-	Aliases     map[string]string `toml:"aliases"`
-	Scripts     map[string]string `toml:"scripts"`
-	Hooks       Hooks             `toml:"hooks"`
+	Name        string             `toml:"name"`
+	AutoApply   bool               `toml:"auto_apply"`
+	Environment map[string]string  `toml:"-"`
+	Sources     map[string]Source  `toml:"-"`
+	Aliases     map[string]string  `toml:"aliases"`
+	Scripts     map[string]string  `toml:"-"`
+	Hooks       Hooks              `toml:"hooks"`
+	Services    map[string]Service `toml:"services"`
+
+	// ScriptCompletions holds the argument completion of scripts written
+	// as tables, by script name
+	ScriptCompletions map[string]ScriptCompletion `toml:"-"`
+
+	// Aliases and hook bodies are only $VAR-expanded when opted in
+	ExpandAliases bool `toml:"expand_aliases"`
+	ExpandHooks   bool `toml:"expand_hooks"`
+
+	// Environment values, aliases and scripts are Go templates when enabled
+	Templates     bool     `toml:"templates"`
+	TemplateAllow []string `toml:"template_allow"`
+
+	// Layers lists the files this config was loaded from, base first
+	Layers []string `toml:"-"`
+	// Origins names the file that defined each environment value, alias
+	// and script, by template name such as "environment.CC"
+	Origins map[string]string `toml:"-"`
 }
 
 type Hooks struct {
-	PreApply  string `toml:"pre_apply"`
-	PostApply string `toml:"post_apply"`
-	OnLeave   string `toml:"on_leave"`
+	PreApply       Hook         `toml:"pre_apply"`
+	PostApply      Hook         `toml:"post_apply"`
+	OnLeave        Hook         `toml:"on_leave"`
+	OnChange       []ChangeHook `toml:"on_change"`
+	OnEnter        Hook         `toml:"on_enter"`
+	OnEnterSubdir  Hook         `toml:"on_enter_subdir"`
+	OnConfigChange Hook         `toml:"on_config_change"`
+	PreRun         Hook         `toml:"pre_run"`
+	PostRun        Hook         `toml:"post_run"`
 }
 
 const (
@@ -55,95 +82,223 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse TOML: %w", err)
 	}
 
-	if cfg.Environment == nil {
-		cfg.Environment = make(map[string]string)
+	// Environment entries and scripts are either plain strings or tables,
+	// so they are decoded separately from the rest of the config.
+	var raw struct {
+		Environment map[string]toml.Primitive `toml:"environment"`
+		Scripts     map[string]toml.Primitive `toml:"scripts"`
+	}
+	md, err := toml.Decode(string(data), &raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TOML: %w", err)
+	}
+
+	for i, hook := range cfg.Hooks.OnChange {
+		if err := hook.validate(); err != nil {
+			return nil, fmt.Errorf("hooks.on_change[%d]: %w", i, err)
+		}
+	}
+
+	for name, svc := range cfg.Services {
+		if err := svc.validate(); err != nil {
+			return nil, fmt.Errorf("services.%s: %w", name, err)
+		}
+	}
+
+	cfg.Layers = []string{path}
+	cfg.Environment = make(map[string]string)
+	cfg.Sources = make(map[string]Source)
+	for key, prim := range raw.Environment {
+		if err := decodeEnvironmentValue(md, prim, key, &cfg); err != nil {
+			return nil, err
+		}
 	}
+
+	cfg.Scripts = make(map[string]string)
+	cfg.ScriptCompletions = make(map[string]ScriptCompletion)
+	for name, prim := range raw.Scripts {
+		if err := decodeScript(md, prim, name, &cfg); err != nil {
+			return nil, err
+		}
+	}
+
 	if cfg.Aliases == nil {
 		cfg.Aliases = make(map[string]string)
 	}
-	if cfg.Scripts == nil {
-		cfg.Scripts = make(map[string]string)
+	if cfg.Services == nil {
+		cfg.Services = make(map[string]Service)
+	}
+
+	cfg.Origins = make(map[string]string)
+	for key := range cfg.Environment {
+		cfg.Origins["environment."+key] = path
+	}
+	for name := range cfg.Aliases {
+		cfg.Origins["aliases."+name] = path
+	}
+	for name := range cfg.Scripts {
+		cfg.Origins["scripts."+name] = path
 	}
 
 	return &cfg, nil
 }
 
+// FindConfig loads the config for startDir and returns it with its path,
+// or nil if there is none. Sources aren't resolved; see ResolveSources.
 func FindConfig(startDir string) (*Config, string, error) {
+	configPath := FindConfigPath(startDir)
+	if configPath == "" {
+		return nil, "", nil
+	}
+
+	cfg, err := LoadProjectConfig(configPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return cfg, configPath, nil
+}
+
+// FindConfigPath returns the path of the config file in startDir or its
+// nearest parent, or "" if there is none.
+func FindConfigPath(startDir string) string {
 	dir := startDir
 
 	for {
 		configPath := filepath.Join(dir, ConfigFileName)
-
 		if _, err := os.Stat(configPath); err == nil {
-			cfg, err := LoadConfig(configPath)
-			if err != nil {
-				return nil, "", err
-			}
-
-			// Try to load local overrides
-			localConfigPath := filepath.Join(dir, LocalConfigFileName)
-			if _, err := os.Stat(localConfigPath); err == nil {
-				localCfg, err := LoadConfig(localConfigPath)
-				if err != nil {
-					return nil, "", fmt.Errorf("failed to load local config: %w", err)
-				}
-				cfg = MergeConfigs(cfg, localCfg)
-			}
-
-			return cfg, configPath, nil
+			return configPath
 		}
 
 		parent := filepath.Dir(dir)
 		if parent == dir {
-			break
+			return ""
 		}
 		dir = parent
 	}
+}
+
+// LoadProjectConfig loads configPath merged with the local overrides next
+// to it.
+func LoadProjectConfig(configPath string) (*Config, error) {
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try to load local overrides
+	localConfigPath := filepath.Join(filepath.Dir(configPath), LocalConfigFileName)
+	if _, err := os.Stat(localConfigPath); err == nil {
+		localCfg, err := LoadConfig(localConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load local config: %w", err)
+		}
+		cfg = MergeConfigs(cfg, localCfg)
+	}
 
-	return nil, "", nil
+	return cfg, nil
 }
 
 func MergeConfigs(base, override *Config) *Config {
 	merged := &Config{
-		AutoApply:   override.AutoApply || base.AutoApply,
-		Environment: make(map[string]string),
-		Aliases:     make(map[string]string),
-		Scripts:     make(map[string]string),
-		Hooks:       base.Hooks, // Start with base hooks
+		Name:          base.Name,
+		AutoApply:     override.AutoApply || base.AutoApply,
+		ExpandAliases: override.ExpandAliases || base.ExpandAliases,
+		ExpandHooks:   override.ExpandHooks || base.ExpandHooks,
+		Templates:     override.Templates || base.Templates,
+		TemplateAllow: append(append([]string{}, base.TemplateAllow...), override.TemplateAllow...),
+		Environment:   make(map[string]string),
+		Sources:       make(map[string]Source),
+		Aliases:       make(map[string]string),
+		Scripts:       make(map[string]string),
+		Services:      make(map[string]Service),
+		Hooks:         base.Hooks, // Start with base hooks
+		Layers:        append(append([]string{}, base.Layers...), override.Layers...),
+		Origins:       make(map[string]string),
+
+		ScriptCompletions: make(map[string]ScriptCompletion),
+	}
+
+	if override.Name != "" {
+		merged.Name = override.Name
 	}
 
 	// Copy base values
 	for k, v := range base.Environment {
 		merged.Environment[k] = v
 	}
+	for k, v := range base.Sources {
+		merged.Sources[k] = v
+	}
 	for k, v := range base.Aliases {
 		merged.Aliases[k] = v
 	}
 	for k, v := range base.Scripts {
 		merged.Scripts[k] = v
 	}
+	for k, v := range base.ScriptCompletions {
+		merged.ScriptCompletions[k] = v
+	}
+	for k, v := range base.Services {
+		merged.Services[k] = v
+	}
 
-	// Override with local values
+	// Override with local values. A variable is either literal or sourced,
+	// so an override of one form replaces the other.
 	for k, v := range override.Environment {
 		merged.Environment[k] = v
+		delete(merged.Sources, k)
+	}
+	for k, v := range override.Sources {
+		merged.Sources[k] = v
+		delete(merged.Environment, k)
 	}
 	for k, v := range override.Aliases {
 		merged.Aliases[k] = v
 	}
+	// A script redefined without completion loses the base's
 	for k, v := range override.Scripts {
 		merged.Scripts[k] = v
+		delete(merged.ScriptCompletions, k)
+	}
+	for k, v := range override.ScriptCompletions {
+		merged.ScriptCompletions[k] = v
+	}
+	for k, v := range override.Services {
+		merged.Services[k] = v
+	}
+	for _, origins := range []map[string]string{base.Origins, override.Origins} {
+		for k, v := range origins {
+			merged.Origins[k] = v
+		}
 	}
 
 	// Override hooks if they exist in local config
-	if override.Hooks.PreApply != "" {
+	if override.Hooks.PreApply.IsSet() {
 		merged.Hooks.PreApply = override.Hooks.PreApply
 	}
-	if override.Hooks.PostApply != "" {
+	if override.Hooks.PostApply.IsSet() {
 		merged.Hooks.PostApply = override.Hooks.PostApply
 	}
-	if override.Hooks.OnLeave != "" {
+	if override.Hooks.OnLeave.IsSet() {
 		merged.Hooks.OnLeave = override.Hooks.OnLeave
 	}
+	if override.Hooks.OnEnter.IsSet() {
+		merged.Hooks.OnEnter = override.Hooks.OnEnter
+	}
+	if override.Hooks.OnEnterSubdir.IsSet() {
+		merged.Hooks.OnEnterSubdir = override.Hooks.OnEnterSubdir
+	}
+	if override.Hooks.OnConfigChange.IsSet() {
+		merged.Hooks.OnConfigChange = override.Hooks.OnConfigChange
+	}
+	if override.Hooks.PreRun.IsSet() {
+		merged.Hooks.PreRun = override.Hooks.PreRun
+	}
+	if override.Hooks.PostRun.IsSet() {
+		merged.Hooks.PostRun = override.Hooks.PostRun
+	}
+	merged.Hooks.OnChange = append(append([]ChangeHook{}, base.Hooks.OnChange...), override.Hooks.OnChange...)
 
 	return merged
 }
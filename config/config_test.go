@@ -19,6 +19,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -116,6 +117,44 @@ func TestFindConfigNotFound(t *testing.T) {
 	}
 }
 
+func TestLoadProjectConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	subDir := filepath.Join(tmpDir, "sub")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+	configContent := `[environment]
+GIT_SHA = { command = "echo abc123" }
+MODE = "base"`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	localPath := filepath.Join(tmpDir, LocalConfigFileName)
+	if err := os.WriteFile(localPath, []byte("[environment]\nMODE = \"local\""), 0644); err != nil {
+		t.Fatalf("Failed to write local config: %v", err)
+	}
+
+	if found := FindConfigPath(subDir); found != configPath {
+		t.Fatalf("Expected config path %s, got %q", configPath, found)
+	}
+	if found := FindConfigPath(t.TempDir()); found != "" {
+		t.Errorf("Expected no config path, got %s", found)
+	}
+
+	cfg, err := LoadProjectConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Environment["MODE"] != "local" {
+		t.Errorf("Expected local override, got %q", cfg.Environment["MODE"])
+	}
+	if value := cfg.Sources["GIT_SHA"].Value; value != "" {
+		t.Errorf("Expected source to be left unresolved, got %q", value)
+	}
+}
+
 func TestLocalConfigMerging(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -198,3 +237,194 @@ setup = "echo local setup"
 		t.Errorf("Expected setup script from local, got %s", cfg.Scripts["setup"])
 	}
 }
+
+func TestLoadConfigEncryptedValue(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configContent := `
+[environment]
+DB_HOST = "localhost"
+DB_PASSWORD = { encrypted = "direnv-secret:v1:AAAA" }
+`
+
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Environment["DB_HOST"] != "localhost" {
+		t.Errorf("Expected DB_HOST=localhost, got %s", cfg.Environment["DB_HOST"])
+	}
+
+	if _, exists := cfg.Environment["DB_PASSWORD"]; exists {
+		t.Error("Expected DB_PASSWORD to be a source, not a plain value")
+	}
+
+	if cfg.Sources["DB_PASSWORD"].Encrypted != "direnv-secret:v1:AAAA" {
+		t.Errorf("Expected encrypted source for DB_PASSWORD, got %+v", cfg.Sources["DB_PASSWORD"])
+	}
+}
+
+func TestLoadConfigInvalidEnvironmentValue(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(configPath, []byte("[environment]\nPORT = 8080\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	_, err := LoadConfig(configPath)
+	if err == nil {
+		t.Fatal("Expected error for non-string environment value")
+	}
+	if !strings.Contains(err.Error(), "PORT") {
+		t.Errorf("Expected error to name the variable, got: %v", err)
+	}
+}
+
+func TestMergeConfigsSources(t *testing.T) {
+	base := &Config{
+		Environment: map[string]string{"TOKEN": "plain"},
+		Sources:     map[string]Source{"PASSWORD": {Encrypted: "base"}},
+	}
+	override := &Config{
+		Environment: map[string]string{"PASSWORD": "local"},
+		Sources:     map[string]Source{"TOKEN": {Encrypted: "override"}},
+	}
+
+	merged := MergeConfigs(base, override)
+
+	if merged.Environment["PASSWORD"] != "local" {
+		t.Errorf("Expected local PASSWORD to override base secret, got %q", merged.Environment["PASSWORD"])
+	}
+	if _, exists := merged.Sources["PASSWORD"]; exists {
+		t.Error("Expected base PASSWORD source to be replaced")
+	}
+	if merged.Sources["TOKEN"].Encrypted != "override" {
+		t.Errorf("Expected TOKEN source from override, got %+v", merged.Sources["TOKEN"])
+	}
+	if _, exists := merged.Environment["TOKEN"]; exists {
+		t.Error("Expected base TOKEN value to be replaced")
+	}
+}
+
+func TestLoadConfigServices(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+
+	content := `
+[services.db]
+run = "postgres -D .pgdata"
+dir = "db"
+env = { PGPORT = "5432" }
+ready = { tcp = "localhost:5432", timeout = "1m" }
+restart = "on-failure"
+autostart = true
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, ok := cfg.Services["db"]
+	if !ok {
+		t.Fatal("Expected db service")
+	}
+	if db.Run != "postgres -D .pgdata" || db.Dir != "db" || db.Env["PGPORT"] != "5432" || !db.Autostart {
+		t.Errorf("Unexpected service: %+v", db)
+	}
+	if db.Ready.TCP != "localhost:5432" || db.ReadyTimeout().String() != "1m0s" || db.RestartPolicy() != RestartOnFailure {
+		t.Errorf("Unexpected readiness or restart settings: %+v", db)
+	}
+
+	merged := MergeConfigs(cfg, &Config{Services: map[string]Service{"mock": {Run: "mockserver"}}})
+	if len(merged.Services) != 2 {
+		t.Errorf("Expected services to merge, got %v", merged.Services)
+	}
+
+	for _, invalid := range []string{
+		"[services.db]\ndir = \"db\"\n",
+		"[services.db]\nrun = \"x\"\nrestart = \"sometimes\"\n",
+		"[services.db]\nrun = \"x\"\nready = { tcp = \"5432\" }\n",
+	} {
+		if err := os.WriteFile(configPath, []byte(invalid), 0644); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+		if _, err := LoadConfig(configPath); err == nil {
+			t.Errorf("Expected error loading %q", invalid)
+		}
+	}
+}
+
+func TestLoadConfigScriptTables(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+
+	content := `
+[scripts]
+build = "make"
+
+[scripts.deploy]
+run = "./deploy.sh $1"
+complete = ["staging", "prod"]
+
+[scripts.migrate]
+run = "./migrate.sh"
+complete_command = "printf '%s\n' up down \"$1\""
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Scripts["build"] != "make" || cfg.Scripts["deploy"] != "./deploy.sh $1" || cfg.Scripts["migrate"] != "./migrate.sh" {
+		t.Errorf("Unexpected scripts: %v", cfg.Scripts)
+	}
+	if _, ok := cfg.ScriptCompletions["build"]; ok {
+		t.Error("Expected no completion for a plain script")
+	}
+
+	words, err := cfg.ScriptCompletions["deploy"].Candidates(tmpDir, nil)
+	if err != nil || strings.Join(words, " ") != "staging prod" {
+		t.Errorf("Expected deploy to complete staging and prod, got %v, %v", words, err)
+	}
+	words, err = cfg.ScriptCompletions["migrate"].Candidates(tmpDir, []string{"typed"})
+	if err != nil || strings.Join(words, " ") != "up down typed" {
+		t.Errorf("Expected migrate's command to get the typed arguments, got %v, %v", words, err)
+	}
+
+	// A script redefined locally loses the base's completion
+	merged := MergeConfigs(cfg, &Config{Scripts: map[string]string{"deploy": "./local-deploy.sh"}})
+	if _, ok := merged.ScriptCompletions["deploy"]; ok {
+		t.Error("Expected the override to drop deploy's completion")
+	}
+	if _, ok := merged.ScriptCompletions["migrate"]; !ok {
+		t.Error("Expected migrate's completion to be kept")
+	}
+
+	for _, invalid := range []string{
+		"[scripts.deploy]\ncomplete = [\"prod\"]\n",
+		"[scripts.deploy]\nrun = \"x\"\ncomplete = [\"prod\"]\ncomplete_command = \"ls\"\n",
+		"[scripts]\ndeploy = 1\n",
+	} {
+		if err := os.WriteFile(configPath, []byte(invalid), 0644); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+		if _, err := LoadConfig(configPath); err == nil {
+			t.Errorf("Expected error loading %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Failure policies for hooks.
+const (
+	OnFailureAbort = "abort"
+	OnFailureWarn  = "warn"
+)
+
+// DefaultHookTimeout bounds how long a hook may run unless it sets timeout.
+const DefaultHookTimeout = 30 * time.Second
+
+// Hook is a shell snippet run by direnv at a lifecycle event. In TOML it is
+// either a plain string or a table:
+//
+//	pre_apply = "make deps"
+//
+//	[hooks.post_apply]
+//	run = "make warm-cache"
+//	timeout = "2m"
+//	on_failure = "warn"
+type Hook struct {
+	Run       string `toml:"run" json:"run"`
+	Timeout   string `toml:"timeout" json:"timeout,omitempty"`
+	OnFailure string `toml:"on_failure" json:"on_failure,omitempty"`
+	// Async hooks are started in the background and not waited for
+	Async bool `toml:"async" json:"async,omitempty"`
+}
+
+// UnmarshalTOML accepts both the string and the table form.
+func (h *Hook) UnmarshalTOML(data interface{}) error {
+	switch v := data.(type) {
+	case string:
+		*h = Hook{Run: v}
+		return nil
+	case map[string]interface{}:
+		*h = Hook{}
+		for key, value := range v {
+			switch key {
+			case "run":
+				if err := setHookString(&h.Run, key, value); err != nil {
+					return err
+				}
+			case "timeout":
+				if err := setHookString(&h.Timeout, key, value); err != nil {
+					return err
+				}
+			case "on_failure":
+				if err := setHookString(&h.OnFailure, key, value); err != nil {
+					return err
+				}
+			case "async":
+				async, ok := value.(bool)
+				if !ok {
+					return fmt.Errorf("hook option 'async' must be a boolean")
+				}
+				h.Async = async
+			default:
+				return fmt.Errorf("unknown hook option '%s'", key)
+			}
+		}
+		return h.validate()
+	default:
+		return fmt.Errorf("hook must be a string or a table, got %T", data)
+	}
+}
+
+func setHookString(field *string, key string, value interface{}) error {
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("hook option '%s' must be a string", key)
+	}
+	*field = s
+	return nil
+}
+
+func (h Hook) validate() error {
+	if h.Run == "" {
+		return fmt.Errorf("hook table must set 'run'")
+	}
+	if h.Timeout != "" {
+		if _, err := time.ParseDuration(h.Timeout); err != nil {
+			return fmt.Errorf("invalid hook timeout %q: %w", h.Timeout, err)
+		}
+	}
+	switch h.OnFailure {
+	case "", OnFailureAbort, OnFailureWarn:
+	default:
+		return fmt.Errorf("invalid on_failure %q (expected %q or %q)", h.OnFailure, OnFailureAbort, OnFailureWarn)
+	}
+	if h.Async && h.OnFailure == OnFailureAbort {
+		return fmt.Errorf("async hooks are not waited for and can't abort")
+	}
+	if h.Async && h.Timeout != "" {
+		return fmt.Errorf("async hooks run until they finish or are cancelled and don't take a timeout")
+	}
+	return nil
+}
+
+// IsSet reports whether the hook has anything to run.
+func (h Hook) IsSet() bool {
+	return h.Run != ""
+}
+
+// TimeoutDuration returns the hook's timeout, or DefaultHookTimeout.
+func (h Hook) TimeoutDuration() time.Duration {
+	if h.Timeout != "" {
+		if d, err := time.ParseDuration(h.Timeout); err == nil {
+			return d
+		}
+	}
+	return DefaultHookTimeout
+}
+
+// Aborts reports whether a failure of this hook should abort the operation
+// it belongs to. defaultPolicy applies when on_failure is not set.
+func (h Hook) Aborts(defaultPolicy string) bool {
+	policy := h.OnFailure
+	if policy == "" {
+		policy = defaultPolicy
+	}
+	return policy == OnFailureAbort
+}
+
+// ChangeHook runs when the contents of any of its files changed since it
+// last ran successfully:
+//
+//	[[hooks.on_change]]
+//	files = ["package-lock.json"]
+//	run = "npm ci"
+type ChangeHook struct {
+	Files     []string `toml:"files" json:"files"`
+	Run       string   `toml:"run" json:"run"`
+	Timeout   string   `toml:"timeout" json:"timeout,omitempty"`
+	OnFailure string   `toml:"on_failure" json:"on_failure,omitempty"`
+	Async     bool     `toml:"async" json:"async,omitempty"`
+}
+
+// Hook returns the runnable part of the change hook.
+func (c ChangeHook) Hook() Hook {
+	return Hook{Run: c.Run, Timeout: c.Timeout, OnFailure: c.OnFailure, Async: c.Async}
+}
+
+func (c ChangeHook) validate() error {
+	if len(c.Files) == 0 {
+		return fmt.Errorf("on_change hook must list 'files'")
+	}
+	return c.Hook().validate()
+}
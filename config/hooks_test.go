@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestConfigWithHooks(t *testing.T) {
@@ -47,16 +48,16 @@ on_leave = "echo bye"
 		t.Fatalf("Failed to load config: %v", err)
 	}
 
-	if cfg.Hooks.PreApply != "echo pre" {
-		t.Errorf("Expected pre_apply hook, got %s", cfg.Hooks.PreApply)
+	if cfg.Hooks.PreApply.Run != "echo pre" {
+		t.Errorf("Expected pre_apply hook, got %s", cfg.Hooks.PreApply.Run)
 	}
 
-	if cfg.Hooks.PostApply != "echo post" {
-		t.Errorf("Expected post_apply hook, got %s", cfg.Hooks.PostApply)
+	if cfg.Hooks.PostApply.Run != "echo post" {
+		t.Errorf("Expected post_apply hook, got %s", cfg.Hooks.PostApply.Run)
 	}
 
-	if cfg.Hooks.OnLeave != "echo bye" {
-		t.Errorf("Expected on_leave hook, got %s", cfg.Hooks.OnLeave)
+	if cfg.Hooks.OnLeave.Run != "echo bye" {
+		t.Errorf("Expected on_leave hook, got %s", cfg.Hooks.OnLeave.Run)
 	}
 }
 
@@ -65,8 +66,8 @@ func TestMergeConfigsWithHooks(t *testing.T) {
 		AutoApply:   false,
 		Environment: map[string]string{"BASE": "value"},
 		Hooks: Hooks{
-			PreApply:  "echo base pre",
-			PostApply: "echo base post",
+			PreApply:  Hook{Run: "echo base pre"},
+			PostApply: Hook{Run: "echo base post"},
 		},
 	}
 
@@ -74,22 +75,188 @@ func TestMergeConfigsWithHooks(t *testing.T) {
 		AutoApply:   true,
 		Environment: map[string]string{"OVERRIDE": "value"},
 		Hooks: Hooks{
-			PreApply: "echo override pre",
-			OnLeave:  "echo override leave",
+			PreApply: Hook{Run: "echo override pre"},
+			OnLeave:  Hook{Run: "echo override leave"},
 		},
 	}
 
 	merged := MergeConfigs(base, override)
 
-	if merged.Hooks.PreApply != "echo override pre" {
-		t.Errorf("Expected overridden pre_apply hook, got %s", merged.Hooks.PreApply)
+	if merged.Hooks.PreApply.Run != "echo override pre" {
+		t.Errorf("Expected overridden pre_apply hook, got %s", merged.Hooks.PreApply.Run)
 	}
 
-	if merged.Hooks.PostApply != "echo base post" {
-		t.Errorf("Expected base post_apply hook, got %s", merged.Hooks.PostApply)
+	if merged.Hooks.PostApply.Run != "echo base post" {
+		t.Errorf("Expected base post_apply hook, got %s", merged.Hooks.PostApply.Run)
 	}
 
-	if merged.Hooks.OnLeave != "echo override leave" {
-		t.Errorf("Expected override on_leave hook, got %s", merged.Hooks.OnLeave)
+	if merged.Hooks.OnLeave.Run != "echo override leave" {
+		t.Errorf("Expected override on_leave hook, got %s", merged.Hooks.OnLeave.Run)
+	}
+}
+
+func TestConfigWithHookTables(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configContent := `
+[hooks]
+pre_apply = "echo pre"
+
+[hooks.post_apply]
+run = "echo post"
+timeout = "2m"
+on_failure = "abort"
+`
+
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Hooks.PreApply.Run != "echo pre" || cfg.Hooks.PreApply.TimeoutDuration() != DefaultHookTimeout {
+		t.Errorf("Unexpected string-form hook: %+v", cfg.Hooks.PreApply)
+	}
+
+	post := cfg.Hooks.PostApply
+	if post.Run != "echo post" {
+		t.Errorf("Expected post_apply run, got %q", post.Run)
+	}
+	if post.TimeoutDuration() != 2*time.Minute {
+		t.Errorf("Expected 2m timeout, got %v", post.TimeoutDuration())
+	}
+	if !post.Aborts(OnFailureWarn) {
+		t.Error("Expected explicit on_failure = abort to override the default policy")
+	}
+	if cfg.Hooks.PreApply.Aborts(OnFailureWarn) {
+		t.Error("Expected default policy to apply when on_failure is unset")
+	}
+}
+
+func TestConfigWithInvalidHook(t *testing.T) {
+	tests := []string{
+		"[hooks.pre_apply]\ntimeout = \"1s\"\n",
+		"[hooks.pre_apply]\nrun = \"x\"\non_failure = \"ignore\"\n",
+		"[hooks.pre_apply]\nrun = \"x\"\ntimeout = \"soon\"\n",
+		"[hooks.pre_apply]\nrun = \"x\"\nretries = \"3\"\n",
+		"[hooks]\npre_apply = 3\n",
+	}
+
+	for _, content := range tests {
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, ConfigFileName)
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+		if _, err := LoadConfig(configPath); err == nil {
+			t.Errorf("Expected error loading %q", content)
+		}
+	}
+}
+
+func TestConfigWithChangeHooks(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configContent := `
+[[hooks.on_change]]
+files = ["package-lock.json"]
+run = "npm ci"
+timeout = "5m"
+
+[[hooks.on_change]]
+files = ["go.mod", "go.sum"]
+run = "go mod download"
+`
+
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if len(cfg.Hooks.OnChange) != 2 {
+		t.Fatalf("Expected 2 on_change hooks, got %d", len(cfg.Hooks.OnChange))
+	}
+	first := cfg.Hooks.OnChange[0]
+	if first.Run != "npm ci" || len(first.Files) != 1 || first.Hook().TimeoutDuration() != 5*time.Minute {
+		t.Errorf("Unexpected first on_change hook: %+v", first)
+	}
+
+	local := &Config{Hooks: Hooks{OnChange: []ChangeHook{{Files: []string{"Gemfile.lock"}, Run: "bundle"}}}}
+	merged := MergeConfigs(cfg, local)
+	if len(merged.Hooks.OnChange) != 3 || merged.Hooks.OnChange[2].Run != "bundle" {
+		t.Errorf("Expected local on_change hooks to be appended, got %+v", merged.Hooks.OnChange)
+	}
+
+	if err := os.WriteFile(configPath, []byte("[[hooks.on_change]]\nrun = \"npm ci\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil {
+		t.Error("Expected error for on_change hook without files")
+	}
+}
+
+func TestMergeConfigsLifecycleHooks(t *testing.T) {
+	base := &Config{
+		Hooks: Hooks{
+			OnEnter: Hook{Run: "echo welcome"},
+			PreRun:  Hook{Run: "echo base pre-run"},
+		},
+	}
+	override := &Config{
+		Hooks: Hooks{
+			PreRun:         Hook{Run: "echo local pre-run"},
+			PostRun:        Hook{Run: "echo done"},
+			OnConfigChange: Hook{Run: "echo changed"},
+		},
+	}
+
+	merged := MergeConfigs(base, override)
+	if merged.Hooks.OnEnter.Run != "echo welcome" {
+		t.Errorf("Expected base on_enter to be kept, got %q", merged.Hooks.OnEnter.Run)
+	}
+	if merged.Hooks.PreRun.Run != "echo local pre-run" {
+		t.Errorf("Expected pre_run to be overridden, got %q", merged.Hooks.PreRun.Run)
+	}
+	if merged.Hooks.PostRun.Run != "echo done" || merged.Hooks.OnConfigChange.Run != "echo changed" {
+		t.Errorf("Expected local-only hooks to be added, got %+v", merged.Hooks)
+	}
+}
+
+func TestConfigWithAsyncHook(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+
+	content := "[hooks.post_apply]\nrun = \"make warm-cache\"\nasync = true\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !cfg.Hooks.PostApply.Async {
+		t.Error("Expected post_apply to be async")
+	}
+
+	for _, invalid := range []string{
+		"[hooks.post_apply]\nrun = \"x\"\nasync = true\non_failure = \"abort\"\n",
+		"[hooks.post_apply]\nrun = \"x\"\nasync = true\ntimeout = \"1m\"\n",
+		"[hooks.post_apply]\nrun = \"x\"\nasync = \"yes\"\n",
+	} {
+		if err := os.WriteFile(configPath, []byte(invalid), 0644); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+		if _, err := LoadConfig(configPath); err == nil {
+			t.Errorf("Expected error loading %q", invalid)
+		}
 	}
 }
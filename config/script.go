@@ -0,0 +1,118 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ScriptCompletion declares how the arguments of a script complete, for
+// both direnv run and the function the script is exported as. A script
+// with one is written as a table:
+//
+//	[scripts.deploy]
+//	run = "./deploy.sh $1"
+//	complete = ["staging", "prod"]
+//
+//	[scripts.migrate]
+//	run = "./migrate.sh $1"
+//	complete_command = "ls migrations/"
+type ScriptCompletion struct {
+	Words []string `toml:"complete" json:"complete,omitempty"`
+	// Command prints one candidate per line. It runs from the project root
+	// with the arguments typed so far as $1, $2, ...
+	Command string `toml:"complete_command" json:"complete_command,omitempty"`
+}
+
+// scriptTable is the table form of a script.
+type scriptTable struct {
+	Run string `toml:"run"`
+	ScriptCompletion
+}
+
+// DefaultCompletionTimeout bounds how long a complete_command may run.
+const DefaultCompletionTimeout = 2 * time.Second
+
+func decodeScript(md toml.MetaData, prim toml.Primitive, name string, cfg *Config) error {
+	var value interface{}
+	if err := md.PrimitiveDecode(prim, &value); err != nil {
+		return fmt.Errorf("script %s: %w", name, err)
+	}
+
+	switch v := value.(type) {
+	case string:
+		cfg.Scripts[name] = v
+	case map[string]interface{}:
+		var table scriptTable
+		if err := md.PrimitiveDecode(prim, &table); err != nil {
+			return fmt.Errorf("script %s: %w", name, err)
+		}
+		if table.Run == "" {
+			return fmt.Errorf("script %s: table must set 'run'", name)
+		}
+		if len(table.Words) > 0 && table.Command != "" {
+			return fmt.Errorf("script %s: set either 'complete' or 'complete_command'", name)
+		}
+		cfg.Scripts[name] = table.Run
+		if len(table.Words) > 0 || table.Command != "" {
+			cfg.ScriptCompletions[name] = table.ScriptCompletion
+		}
+	default:
+		return fmt.Errorf("script %s: value must be a string or a table", name)
+	}
+
+	return nil
+}
+
+// Candidates returns the completions of the next argument of the script,
+// given the arguments before it. dir is the project root.
+func (c ScriptCompletion) Candidates(dir string, args []string) ([]string, error) {
+	if c.Command == "" {
+		return c.Words, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultCompletionTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", c.Command, "direnv"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "PROJECT_ROOT="+dir)
+	cmd.WaitDelay = 100 * time.Millisecond
+
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("complete_command timed out after %s: %s", DefaultCompletionTimeout, c.Command)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("complete_command failed: %w", err)
+	}
+
+	var words []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			words = append(words, line)
+		}
+	}
+	return words, nil
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Restart policies for services.
+const (
+	RestartNo        = "no"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// DefaultReadyTimeout bounds how long `direnv up` waits for a service to
+// become ready.
+const DefaultReadyTimeout = 30 * time.Second
+
+// Service is a long-running process that belongs to the project:
+//
+//	[services.db]
+//	run = "postgres -D .pgdata"
+//	ready = { tcp = "localhost:5432" }
+//	restart = "on-failure"
+//	autostart = true
+type Service struct {
+	Run       string            `toml:"run"`
+	Dir       string            `toml:"dir"` // relative to the project root
+	Env       map[string]string `toml:"env"`
+	Ready     Ready             `toml:"ready"`
+	Restart   string            `toml:"restart"`
+	Autostart bool              `toml:"autostart"`
+}
+
+// Ready describes how to tell that a service is accepting work.
+type Ready struct {
+	TCP     string `toml:"tcp"` // host:port that accepts connections
+	Timeout string `toml:"timeout"`
+}
+
+func (s Service) validate() error {
+	if s.Run == "" {
+		return fmt.Errorf("service must set 'run'")
+	}
+	switch s.Restart {
+	case "", RestartNo, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("invalid restart %q (expected %q, %q or %q)", s.Restart, RestartNo, RestartOnFailure, RestartAlways)
+	}
+	if s.Ready.TCP != "" {
+		if _, _, err := net.SplitHostPort(s.Ready.TCP); err != nil {
+			return fmt.Errorf("invalid ready.tcp %q: %w", s.Ready.TCP, err)
+		}
+	}
+	if s.Ready.Timeout != "" {
+		if _, err := time.ParseDuration(s.Ready.Timeout); err != nil {
+			return fmt.Errorf("invalid ready.timeout %q: %w", s.Ready.Timeout, err)
+		}
+	}
+	return nil
+}
+
+// ReadyTimeout returns how long to wait for the service to become ready.
+func (s Service) ReadyTimeout() time.Duration {
+	if s.Ready.Timeout != "" {
+		if d, err := time.ParseDuration(s.Ready.Timeout); err == nil {
+			return d
+		}
+	}
+	return DefaultReadyTimeout
+}
+
+// RestartPolicy returns the restart policy, defaulting to "no".
+func (s Service) RestartPolicy() string {
+	if s.Restart == "" {
+		return RestartNo
+	}
+	return s.Restart
+}
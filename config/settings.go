@@ -0,0 +1,106 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SettingsFileName is the user settings file in ~/.config/direnv.
+const SettingsFileName = "settings.toml"
+
+// Settings are the user's choices that apply to all projects, written by
+// direnv enable and disable.
+type Settings struct {
+	// AutoApply is the global choice, nil if none was made
+	AutoApply *bool `toml:"auto_apply,omitempty"`
+	// Directories holds the choices made with --here, for a directory and
+	// everything below it
+	Directories map[string]bool `toml:"directories,omitempty"`
+}
+
+// Dir returns ~/.config/direnv, which holds the settings, the state of
+// each shell session and the cached source results.
+func Dir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "direnv"), nil
+}
+
+// SettingsPath returns the path of the user settings file.
+func SettingsPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, SettingsFileName), nil
+}
+
+// LoadSettings reads the user settings. A missing file means no choices.
+func LoadSettings() (*Settings, error) {
+	path, err := SettingsPath()
+	if err != nil {
+		return nil, err
+	}
+	settings := &Settings{}
+	if _, err := toml.DecodeFile(path, settings); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load settings %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Save writes the settings to the user settings file.
+func (s *Settings) Save() error {
+	path, err := SettingsPath()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(s); err != nil {
+		return fmt.Errorf("failed to encode settings: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write settings %s: %w", path, err)
+	}
+	return nil
+}
+
+// DirectoryAutoApply returns the --here choice for dir, made for dir itself
+// or its nearest parent, and the directory it was made for. The last
+// result is false if there is none.
+func (s *Settings) DirectoryAutoApply(dir string) (bool, string, bool) {
+	for {
+		if enabled, ok := s.Directories[dir]; ok {
+			return enabled, dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false, "", false
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSettingsSaveLoad(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	settings, err := LoadSettings()
+	if err != nil {
+		t.Fatalf("Failed to load missing settings: %v", err)
+	}
+	if settings.AutoApply != nil || len(settings.Directories) != 0 {
+		t.Errorf("Expected no choices without a settings file, got %+v", settings)
+	}
+
+	enabled := true
+	settings.AutoApply = &enabled
+	settings.Directories = map[string]bool{"/work/project": false}
+	if err := settings.Save(); err != nil {
+		t.Fatalf("Failed to save settings: %v", err)
+	}
+
+	loaded, err := LoadSettings()
+	if err != nil {
+		t.Fatalf("Failed to load settings: %v", err)
+	}
+	if loaded.AutoApply == nil || !*loaded.AutoApply {
+		t.Errorf("Expected auto_apply = true, got %v", loaded.AutoApply)
+	}
+	if enabled, ok := loaded.Directories["/work/project"]; !ok || enabled {
+		t.Errorf("Expected /work/project disabled, got %v", loaded.Directories)
+	}
+}
+
+func TestDirectoryAutoApply(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "work")
+	settings := &Settings{Directories: map[string]bool{
+		root:                          true,
+		filepath.Join(root, "legacy"): false,
+	}}
+
+	tests := []struct {
+		dir     string
+		enabled bool
+		from    string
+		ok      bool
+	}{
+		{root, true, root, true},
+		{filepath.Join(root, "app", "src"), true, root, true},
+		{filepath.Join(root, "legacy"), false, filepath.Join(root, "legacy"), true},
+		{filepath.Join(root, "legacy", "lib"), false, filepath.Join(root, "legacy"), true},
+		{filepath.Join(root, "legacy-new"), true, root, true},
+		{filepath.Join(string(filepath.Separator), "home"), false, "", false},
+	}
+	for _, tt := range tests {
+		enabled, from, ok := settings.DirectoryAutoApply(tt.dir)
+		if enabled != tt.enabled || from != tt.from || ok != tt.ok {
+			t.Errorf("DirectoryAutoApply(%q) = %v, %q, %v; want %v, %q, %v",
+				tt.dir, enabled, from, ok, tt.enabled, tt.from, tt.ok)
+		}
+	}
+}
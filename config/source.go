@@ -0,0 +1,422 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Source is an environment value written as a table instead of a plain
+// string. Exactly one kind must be set:
+//
+//	DB_PASSWORD  = { encrypted = "direnv-secret:v1:..." }
+//	GIT_SHA      = { command = "git rev-parse HEAD", cache = "5m" }
+//	VERSION      = { file = "VERSION", trim = true }
+//	NODE_VERSION = { json = "package.json", path = "engines.node" }
+//	CRATE        = { toml = "Cargo.toml", path = "package.name" }
+//
+// Command, file and structured sources are evaluated by ResolveSources and
+// their result stored in Value. Encrypted sources are only decrypted at export time.
+type Source struct {
+	Encrypted string `toml:"encrypted"`
+
+	Command string   `toml:"command"`
+	Cache   string   `toml:"cache"`   // how long a command result stays valid
+	Depends []string `toml:"depends"` // files whose contents invalidate the cache
+	Timeout string   `toml:"timeout"`
+
+	File string `toml:"file"`
+	Trim bool   `toml:"trim"`
+
+	JSON string `toml:"json"`
+	TOML string `toml:"toml"`
+	Path string `toml:"path"`
+
+	Value string `toml:"-"`
+	// Hook names the hook that set Value through $DIRENV_ENV_FILE
+	Hook string `toml:"-"`
+}
+
+// DefaultSourceTimeout bounds how long a command source may run.
+const DefaultSourceTimeout = 5 * time.Second
+
+// CacheDir holds cached source results. It lives next to the state files.
+var CacheDir = defaultCacheDir()
+
+func defaultCacheDir() string {
+	dir, err := Dir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "direnv-cache")
+	}
+	return filepath.Join(dir, "cache")
+}
+
+// Kind names the kind of source: "encrypted", "command", "file", "json" or
+// "toml", or "" for a value set by a hook.
+func (s Source) Kind() string {
+	switch {
+	case s.Encrypted != "":
+		return "encrypted"
+	case s.Command != "":
+		return "command"
+	case s.File != "":
+		return "file"
+	case s.JSON != "":
+		return "json"
+	case s.TOML != "":
+		return "toml"
+	}
+	return ""
+}
+
+func (s Source) validate() error {
+	kinds := 0
+	for _, set := range []bool{s.Encrypted != "", s.Command != "", s.File != "", s.JSON != "", s.TOML != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("table must set exactly one of 'encrypted', 'command', 'file', 'json' or 'toml'")
+	}
+	if (s.JSON != "" || s.TOML != "") && s.Path == "" {
+		return fmt.Errorf("'path' is required for structured file lookups")
+	}
+	if s.Command == "" && (s.Cache != "" || len(s.Depends) > 0) {
+		return fmt.Errorf("'cache' and 'depends' only apply to command sources")
+	}
+	if s.Cache != "" {
+		if _, err := time.ParseDuration(s.Cache); err != nil {
+			return fmt.Errorf("invalid cache duration %q: %w", s.Cache, err)
+		}
+	}
+	if s.Timeout != "" {
+		if _, err := time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout %q: %w", s.Timeout, err)
+		}
+	}
+	return nil
+}
+
+// sourceOptions are the keys a source table may set.
+var sourceOptions = map[string]bool{
+	"encrypted": true,
+	"command":   true,
+	"cache":     true,
+	"depends":   true,
+	"timeout":   true,
+	"file":      true,
+	"trim":      true,
+	"json":      true,
+	"toml":      true,
+	"path":      true,
+}
+
+func decodeEnvironmentValue(md toml.MetaData, prim toml.Primitive, key string, cfg *Config) error {
+	var value interface{}
+	if err := md.PrimitiveDecode(prim, &value); err != nil {
+		return fmt.Errorf("environment variable %s: %w", key, err)
+	}
+
+	switch v := value.(type) {
+	case string:
+		cfg.Environment[key] = v
+	case map[string]interface{}:
+		options := make([]string, 0, len(v))
+		for option := range v {
+			options = append(options, option)
+		}
+		sort.Strings(options)
+		for _, option := range options {
+			if !sourceOptions[option] {
+				return fmt.Errorf("environment variable %s: unknown source option '%s'", key, option)
+			}
+		}
+
+		var src Source
+		if err := md.PrimitiveDecode(prim, &src); err != nil {
+			return fmt.Errorf("environment variable %s: %w", key, err)
+		}
+		if err := src.validate(); err != nil {
+			return fmt.Errorf("environment variable %s: %w", key, err)
+		}
+		cfg.Sources[key] = src
+	default:
+		return fmt.Errorf("environment variable %s: value must be a string or a table", key)
+	}
+
+	return nil
+}
+
+// ResolveSources evaluates every command, file and structured source in
+// cfg, relative to the config directory dir. Encrypted sources are left
+// alone. Only the commands that export or run with the environment need
+// the values; the others don't run sources.
+func ResolveSources(cfg *Config, dir string) error {
+	keys := make([]string, 0, len(cfg.Sources))
+	for key := range cfg.Sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		src := cfg.Sources[key]
+		if src.Encrypted != "" {
+			continue
+		}
+		value, err := resolveSource(src, dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("environment variable %s: %w", key, err))
+			continue
+		}
+		src.Value = value
+		cfg.Sources[key] = src
+	}
+
+	return errors.Join(errs...)
+}
+
+// cacheEntry is the on-disk form of a cached source result.
+type cacheEntry struct {
+	Value   string    `json:"value"`
+	Created time.Time `json:"created"`
+}
+
+func resolveSource(src Source, dir string) (string, error) {
+	// Only commands that ask for it are cached; reading a file again costs
+	// no more than reading a cached copy, which would also sit in plain text.
+	cacheable := src.Command != "" && (src.Cache != "" || len(src.Depends) > 0)
+	var cachePath string
+	if cacheable {
+		key, err := sourceCacheKey(src, dir)
+		if err != nil {
+			return "", err
+		}
+		cachePath = filepath.Join(CacheDir, key+".json")
+		if value, ok := readCache(cachePath, src.Cache); ok {
+			return value, nil
+		}
+	}
+
+	var value string
+	var err error
+	switch {
+	case src.Command != "":
+		value, err = runSourceCommand(src, dir)
+	case src.File != "":
+		value, err = readSourceFile(src, dir)
+	case src.JSON != "":
+		value, err = lookupStructured(src.JSON, src.Path, dir, json.Unmarshal)
+	case src.TOML != "":
+		value, err = lookupStructured(src.TOML, src.Path, dir, toml.Unmarshal)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if cacheable {
+		writeCache(cachePath, value)
+	}
+
+	return value, nil
+}
+
+func runSourceCommand(src Source, dir string) (string, error) {
+	timeout := DefaultSourceTimeout
+	if src.Timeout != "" {
+		timeout, _ = time.ParseDuration(src.Timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", src.Command)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "PROJECT_ROOT="+dir)
+	// Don't wait on pipes still held open by children of a killed command
+	cmd.WaitDelay = 100 * time.Millisecond
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("command timed out after %s: %s", timeout, src.Command)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", fmt.Errorf("command failed: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("command failed: %w", err)
+	}
+
+	// Like $(...), drop trailing newlines
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+func readSourceFile(src Source, dir string) (string, error) {
+	data, err := os.ReadFile(resolvePath(dir, src.File))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if src.Trim {
+		return strings.TrimSpace(string(data)), nil
+	}
+	return string(data), nil
+}
+
+// lookupStructured reads a JSON or TOML file and returns the value at a
+// dotted path such as "engines.node" or "workspaces.0".
+func lookupStructured(file, path, dir string, unmarshal func([]byte, interface{}) error) (string, error) {
+	data, err := os.ReadFile(resolvePath(dir, file))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var doc interface{}
+	if err := unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	current := doc
+	for _, part := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, exists := node[part]
+			if !exists {
+				return "", fmt.Errorf("path %q not found in %s", path, file)
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(node) {
+				return "", fmt.Errorf("path %q not found in %s", path, file)
+			}
+			current = node[index]
+		default:
+			return "", fmt.Errorf("path %q not found in %s", path, file)
+		}
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v, nil
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// sourceCacheKey identifies a command result by the command, directory
+// and the current contents of the files it depends on.
+func sourceCacheKey(src Source, dir string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%q\x00", dir, src.Command)
+	for _, dep := range src.Depends {
+		data, err := os.ReadFile(resolvePath(dir, dep))
+		if err != nil {
+			return "", fmt.Errorf("failed to read dependency %s: %w", dep, err)
+		}
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(h, "%s\x00%x\x00", dep, sum)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func readCache(path string, ttl string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return "", false
+	}
+
+	if ttl != "" {
+		maxAge, err := time.ParseDuration(ttl)
+		if err != nil || time.Since(entry.Created) > maxAge {
+			return "", false
+		}
+	}
+
+	return entry.Value, true
+}
+
+// writeCache is best effort: a failure only means the source is evaluated
+// again next time.
+func writeCache(path string, value string) {
+	data, err := json.Marshal(cacheEntry{Value: value, Created: time.Now()})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, data, 0600)
+}
+
+// PruneCache removes the cached source results written more than maxAge
+// ago and returns how many it removed. A result still in use is evaluated
+// again on the next apply.
+func PruneCache(maxAge time.Duration) int {
+	matches, err := filepath.Glob(filepath.Join(CacheDir, "*.json"))
+	if err != nil {
+		return 0
+	}
+
+	pruned := 0
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) <= maxAge {
+			continue
+		}
+		if os.Remove(path) == nil {
+			pruned++
+		}
+	}
+	return pruned
+}
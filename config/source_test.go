@@ -0,0 +1,244 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useTempCacheDir(t *testing.T) {
+	t.Helper()
+	originalCacheDir := CacheDir
+	CacheDir = t.TempDir()
+	t.Cleanup(func() { CacheDir = originalCacheDir })
+}
+
+func TestFindConfigSources(t *testing.T) {
+	useTempCacheDir(t)
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"VERSION":      "1.2.3\n",
+		"package.json": `{"engines": {"node": ">=20"}, "workspaces": ["a", "b"]}`,
+		"Cargo.toml":   "[package]\nname = \"crate\"\n",
+		ConfigFileName: `
+[environment]
+GIT_SHA = { command = "echo abc123" }
+VERSION = { file = "VERSION", trim = true }
+RAW_VERSION = { file = "VERSION" }
+NODE_VERSION = { json = "package.json", path = "engines.node" }
+WORKSPACE = { json = "package.json", path = "workspaces.1" }
+CRATE = { toml = "Cargo.toml", path = "package.name" }
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	cfg, _, err := FindConfig(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to find config: %v", err)
+	}
+	if err := ResolveSources(cfg, tmpDir); err != nil {
+		t.Fatalf("Failed to resolve sources: %v", err)
+	}
+
+	expected := map[string]string{
+		"GIT_SHA":      "abc123",
+		"VERSION":      "1.2.3",
+		"RAW_VERSION":  "1.2.3\n",
+		"NODE_VERSION": ">=20",
+		"WORKSPACE":    "b",
+		"CRATE":        "crate",
+	}
+	for key, want := range expected {
+		if got := cfg.Sources[key].Value; got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	// Only commands that ask for it are cached, so no file contents are copied
+	if entries, _ := os.ReadDir(CacheDir); len(entries) != 0 {
+		t.Errorf("Expected nothing to be cached, found %d entries", len(entries))
+	}
+}
+
+func TestSourceErrorsNameVariable(t *testing.T) {
+	useTempCacheDir(t)
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"missing file", `MISSING = { file = "nope.txt" }`},
+		{"failing command", `BROKEN = { command = "exit 3" }`},
+		{"missing path", `NODE = { json = "package.json", path = "engines.deno" }`},
+		{"timeout", `SLOW = { command = "sleep 5", timeout = "100ms" }`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tmpDir, "package.json"), []byte(`{"engines": {}}`), 0644); err != nil {
+				t.Fatalf("Failed to write package.json: %v", err)
+			}
+			content := "[environment]\n" + tt.config + "\n"
+			if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			cfg, _, err := FindConfig(tmpDir)
+			if err != nil {
+				t.Fatalf("Failed to find config: %v", err)
+			}
+			err = ResolveSources(cfg, tmpDir)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			key := strings.SplitN(tt.config, " ", 2)[0]
+			if !strings.Contains(err.Error(), "environment variable "+key) {
+				t.Errorf("Expected error to name %s, got: %v", key, err)
+			}
+		})
+	}
+}
+
+func TestSourceValidation(t *testing.T) {
+	tests := []string{
+		`A = { }`,
+		`A = { command = "x", file = "y" }`,
+		`A = { json = "package.json" }`,
+		`A = { command = "x", cache = "soon" }`,
+		`A = { command = "x", cahce = "5m" }`,
+		`A = { file = "VERSION", cache = "5m" }`,
+	}
+
+	for _, entry := range tests {
+		t.Run(entry, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, ConfigFileName)
+			if err := os.WriteFile(configPath, []byte("[environment]\n"+entry+"\n"), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+			if _, err := LoadConfig(configPath); err == nil {
+				t.Errorf("Expected validation error for %s", entry)
+			}
+		})
+	}
+}
+
+func TestCommandSourceCache(t *testing.T) {
+	useTempCacheDir(t)
+	tmpDir := t.TempDir()
+
+	counter := filepath.Join(tmpDir, "count")
+	lockFile := filepath.Join(tmpDir, "go.sum")
+	if err := os.WriteFile(lockFile, []byte("v1"), 0644); err != nil {
+		t.Fatalf("Failed to write go.sum: %v", err)
+	}
+
+	src := Source{
+		Command: "echo x >> " + counter + "; wc -l < " + counter,
+		Cache:   "1h",
+		Depends: []string{"go.sum"},
+	}
+
+	first, err := resolveSource(src, tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	second, err := resolveSource(src, tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	if first != second {
+		t.Errorf("Expected cached result %q, got %q", first, second)
+	}
+
+	// Changing a dependency must invalidate the cached value
+	if err := os.WriteFile(lockFile, []byte("v2"), 0644); err != nil {
+		t.Fatalf("Failed to update go.sum: %v", err)
+	}
+	third, err := resolveSource(src, tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	if third == second {
+		t.Errorf("Expected command to re-run after dependency change, still got %q", third)
+	}
+}
+
+func TestFindConfigDoesNotRunSources(t *testing.T) {
+	useTempCacheDir(t)
+	tmpDir := t.TempDir()
+
+	marker := filepath.Join(tmpDir, "ran")
+	content := "[environment]\nSLOW = { command = \"touch " + marker + "\" }\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, _, err := FindConfig(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to find config: %v", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("Expected FindConfig not to run the command")
+	}
+
+	if err := ResolveSources(cfg, tmpDir); err != nil {
+		t.Fatalf("Failed to resolve sources: %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("Expected ResolveSources to run the command")
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	useTempCacheDir(t)
+	if err := os.MkdirAll(CacheDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := filepath.Join(CacheDir, "stale.json")
+	fresh := filepath.Join(CacheDir, "fresh.json")
+	for _, path := range []string{stale, fresh} {
+		if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if pruned := PruneCache(24 * time.Hour); pruned != 1 {
+		t.Errorf("Expected one entry pruned, got %d", pruned)
+	}
+	if _, err := os.Stat(stale); err == nil {
+		t.Error("Expected stale entry to be removed")
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Error("Expected fresh entry to be kept")
+	}
+}
@@ -17,17 +17,28 @@
 package env
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/shell"
 )
 
 func ApplyConfig(cfg *config.Config, baseDir string) error {
+	ctx := NewContext(cfg, baseDir)
 	for key, value := range cfg.Environment {
-		expandedValue := expandEnvVar(value, baseDir)
+		expandedValue, err := expandEnvVar(value, ctx)
+		if err != nil {
+			return fmt.Errorf("failed to expand environment variable %s: %w", key, err)
+		}
 		if err := os.Setenv(key, expandedValue); err != nil {
 			return fmt.Errorf("failed to set environment variable %s: %w", key, err)
 		}
@@ -36,41 +47,95 @@ func ApplyConfig(cfg *config.Config, baseDir string) error {
 	return nil
 }
 
-func expandEnvVar(value string, baseDir string) string {
-	result := value
+func expandEnvVar(value string, ctx *Context) (string, error) {
+	result, _, err := expandValue(value, ctx)
+	return result, err
+}
 
-	result = strings.ReplaceAll(result, "$PROJECT_ROOT", baseDir)
+func ExecuteScript(scriptName, scriptContent string, baseDir string, args ...string) error {
+	return runScript(scriptName, scriptContent, baseDir, nil, args)
+}
 
-	result = os.ExpandEnv(result)
+// ExecuteConfigScript runs a script from cfg with the config's sourced
+// values, including decrypted secrets, in its environment.
+func ExecuteConfigScript(cfg *config.Config, scriptName string, baseDir string, args ...string) error {
+	script, exists := cfg.Scripts[scriptName]
+	if !exists {
+		return fmt.Errorf("script '%s' not found in config", scriptName)
+	}
 
-	return result
-}
+	ctx := NewContext(cfg, baseDir)
+	script, err := renderConfigValue(cfg, ctx, "scripts."+scriptName, script)
+	if err != nil {
+		return err
+	}
 
-func ExecuteScript(scriptName, scriptContent string, baseDir string, args ...string) error {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/sh"
+	sourced, err := sourceValues(cfg.Sources)
+	if err != nil {
+		return err
+	}
+
+	extraEnv := make([]string, 0, len(sourced))
+	for key, value := range sourced {
+		extraEnv = append(extraEnv, key+"="+value)
+	}
+	for key, value := range ctx.Builtins() {
+		extraEnv = append(extraEnv, key+"="+value)
 	}
 
+	hookEnv := append(append([]string{}, extraEnv...), VarScript+"="+scriptName)
+	if _, err := runConfigHook(cfg, ctx, HookPreRun, baseDir, hookEnv); err != nil {
+		if IsAbort(err) {
+			return fmt.Errorf("script '%s' not run: %w", scriptName, err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	scriptErr := runScript(scriptName, script, baseDir, extraEnv, args)
+
+	exitCode := 0
+	if scriptErr != nil {
+		exitCode = 1
+		var exitErr *exec.ExitError
+		if errors.As(scriptErr, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	hookEnv = append(hookEnv, fmt.Sprintf("%s=%d", VarExitCode, exitCode))
+	if _, err := runConfigHook(cfg, ctx, HookPostRun, baseDir, hookEnv); err != nil {
+		if IsAbort(err) && scriptErr == nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	return scriptErr
+}
+
+func runScript(scriptName, scriptContent string, baseDir string, extraEnv []string, args []string) error {
+	scriptPath := scriptShell()
+
 	// Build the script with positional parameters set
 	fullScript := scriptContent
 	if len(args) > 0 {
 		// Prepend set -- to set positional parameters
+		posix := shell.DialectFor(shell.Posix)
 		quotedArgs := make([]string, len(args))
 		for i, arg := range args {
-			quotedArgs[i] = shellQuote(arg)
+			quotedArgs[i] = posix.Quote(arg)
 		}
 		fullScript = fmt.Sprintf("set -- %s\n%s", strings.Join(quotedArgs, " "), scriptContent)
 	}
 
-	cmd := exec.Command(shell, "-c", fullScript)
+	cmd := exec.Command(scriptPath, "-c", fullScript)
 	cmd.Dir = baseDir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
 
 	originalPwd := os.Getenv("PWD")
-	cmd.Env = append(os.Environ(),
+	cmd.Env = append(os.Environ(), extraEnv...)
+	cmd.Env = append(cmd.Env,
 		"PROJECT_ROOT="+baseDir,
 		"PWD="+baseDir,
 	)
@@ -86,43 +151,213 @@ func ExecuteScript(scriptName, scriptContent string, baseDir string, args ...str
 	return nil
 }
 
-func ExportForShell(cfg *config.Config, baseDir string, shellType string) string {
+func ExportForShell(cfg *config.Config, baseDir string, d shell.Dialect) (string, error) {
 	var exports []string
+	ctx := NewContext(cfg, baseDir)
+
+	values, err := buildEnvironment(cfg, ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for key, expandedValue := range values {
+		exports = append(exports, d.SetVar(key, expandedValue))
+	}
+
+	for name, command := range cfg.Aliases {
+		if isTemplate(cfg, command) {
+			rendered, err := renderConfigValue(cfg, ctx, "aliases."+name, command)
+			if err != nil {
+				return "", err
+			}
+			exports = append(exports, d.DefineAlias(name, rendered))
+			continue
+		}
+		command, err := expandAlias(cfg, ctx, command)
+		if err != nil {
+			return "", fmt.Errorf("failed to expand alias %s: %w", name, err)
+		}
+		exports = append(exports, d.DefineAlias(name, command))
+	}
+
+	for name, script := range cfg.Scripts {
+		script, err := renderConfigValue(cfg, ctx, "scripts."+name, script)
+		if err != nil {
+			return "", err
+		}
+		exports = append(exports, d.DefineFunction(name, script, baseDir))
+	}
 
-	// Execute pre-apply hook first
-	if cfg.Hooks.PreApply != "" {
-		exports = append(exports, fmt.Sprintf("(\n    cd %s\n%s\n)", shellQuote(baseDir), indent(cfg.Hooks.PreApply, "    ")))
+	return strings.Join(exports, "\n"), nil
+}
+
+// buildEnvironment returns every variable an apply exports: expanded config
+// values, sourced and decrypted values (verbatim) and the built-ins, which
+// take precedence over config entries of the same name.
+func buildEnvironment(cfg *config.Config, ctx *Context) (map[string]string, error) {
+	sourced, err := sourceValues(cfg.Sources)
+	if err != nil {
+		return nil, err
 	}
 
+	values := make(map[string]string, len(cfg.Environment)+len(sourced))
+	var errs []error
 	for key, value := range cfg.Environment {
-		expandedValue := expandEnvVar(value, baseDir)
-		if shellType == "fish" {
-			exports = append(exports, fmt.Sprintf("set -gx %s %s", key, shellQuote(expandedValue)))
+		expandedValue, err := environmentValue(cfg, ctx, key, value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		values[key] = expandedValue
+	}
+	if len(errs) > 0 {
+		sortErrors(errs)
+		return nil, errors.Join(errs...)
+	}
+
+	for key, value := range sourced {
+		values[key] = value
+	}
+	for key, value := range ctx.Builtins() {
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+// environmentValue renders a literal [environment] value if it's a template,
+// and expands it otherwise.
+func environmentValue(cfg *config.Config, ctx *Context, key, value string) (string, error) {
+	if isTemplate(cfg, value) {
+		return renderConfigValue(cfg, ctx, "environment."+key, value)
+	}
+	expandedValue, err := expandEnvVar(value, ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand %s: %w", key, err)
+	}
+	return expandedValue, nil
+}
+
+// ConfigHash identifies the effective config: the merged definitions,
+// without values resolved from sources or set by hooks.
+func ConfigHash(cfg *config.Config) string {
+	effective := *cfg
+	effective.Sources = make(map[string]config.Source, len(cfg.Sources))
+	for key, src := range cfg.Sources {
+		if src.Hook != "" {
+			continue
+		}
+		src.Value = ""
+		effective.Sources[key] = src
+	}
+
+	// Maps marshal with sorted keys, so equal configs hash equally
+	data, err := json.Marshal(effective)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// UnloadForShell returns shell code undoing the apply recorded in state:
+// variables it set are restored to their previous value or unset, and its
+// aliases and functions are removed.
+func UnloadForShell(state *State, d shell.Dialect) string {
+	var commands []string
+
+	applied := append([]string{}, state.Applied...)
+	sort.Strings(applied)
+	for _, key := range applied {
+		if oldValue, existed := state.Environment[key]; existed {
+			commands = append(commands, d.SetVar(key, oldValue))
 		} else {
-			exports = append(exports, fmt.Sprintf("export %s=%s", key, shellQuote(expandedValue)))
+			commands = append(commands, d.UnsetVar(key))
 		}
 	}
 
-	for name, command := range cfg.Aliases {
-		exports = append(exports, fmt.Sprintf("alias %s=%s", name, shellQuote(command)))
+	aliases := make([]string, 0, len(state.Aliases))
+	for name := range state.Aliases {
+		aliases = append(aliases, name)
+	}
+	sort.Strings(aliases)
+	for _, name := range aliases {
+		if line := d.RemoveAlias(name); line != "" {
+			commands = append(commands, line)
+		}
 	}
 
-	for name, script := range cfg.Scripts {
-		// Inject PROJECT_ROOT into the function and pass all arguments
-		funcDef := fmt.Sprintf("%s() {\n    local PROJECT_ROOT=%s\n    (\n        cd \"$PROJECT_ROOT\"\n        set -- \"$@\"\n%s\n    )\n}", name, shellQuote(baseDir), indent(script, "        "))
-		exports = append(exports, funcDef)
+	for _, name := range state.Functions {
+		if line := d.RemoveFunction(name); line != "" {
+			commands = append(commands, line)
+		}
+	}
+
+	if len(commands) == 0 {
+		return ""
+	}
+	return strings.Join(commands, "\n") + "\n"
+}
+
+// RecordApplied stores in state what applying cfg exports, so that
+// UnloadForShell can undo it later. The caller records the ConfigHash,
+// taken before hooks merge their variables into cfg.
+func RecordApplied(state *State, cfg *config.Config, baseDir string) {
+	ctx := NewContext(cfg, baseDir)
+
+	keys := make(map[string]bool)
+	for key := range cfg.Environment {
+		keys[key] = true
+	}
+	for key := range cfg.Sources {
+		keys[key] = true
+	}
+	for key := range ctx.Builtins() {
+		keys[key] = true
 	}
 
-	// Execute post-apply hook last
-	if cfg.Hooks.PostApply != "" {
-		exports = append(exports, fmt.Sprintf("(\n    cd %s\n%s\n)", shellQuote(baseDir), indent(cfg.Hooks.PostApply, "    ")))
+	state.Project = ctx.Project
+	state.Profile = ctx.Profile
+	state.Layers = ctx.Layers
+	state.AppliedAt = time.Now()
+
+	state.HookEnvironment = make(map[string]HookValue)
+	for key, src := range cfg.Sources {
+		if src.Hook != "" {
+			state.HookEnvironment[key] = HookValue{Hook: src.Hook, Value: src.Value}
+		}
+	}
+
+	state.Applied = make([]string, 0, len(keys))
+	for key := range keys {
+		state.Applied = append(state.Applied, key)
+	}
+	sort.Strings(state.Applied)
+
+	state.Aliases = make(map[string]string, len(cfg.Aliases))
+	for name, command := range cfg.Aliases {
+		state.Aliases[name] = command
 	}
 
-	return strings.Join(exports, "\n")
+	state.Functions = make([]string, 0, len(cfg.Scripts))
+	for name := range cfg.Scripts {
+		state.Functions = append(state.Functions, name)
+	}
+	sort.Strings(state.Functions)
 }
 
-func shellQuote(s string) string {
-	return "'" + strings.ReplaceAll(s, "'", "'\"'\"'") + "'"
+// scriptShell returns the shell that runs scripts and hooks. Their bodies
+// are POSIX shell code, so users of other shells get /bin/sh instead.
+func scriptShell() string {
+	path := os.Getenv("SHELL")
+	switch shell.FromPath(path) {
+	case shell.Fish, shell.Nushell, shell.PowerShell, shell.Tcsh:
+		return "/bin/sh"
+	}
+	if path == "" {
+		return "/bin/sh"
+	}
+	return path
 }
 
 func indent(s string, prefix string) string {
@@ -18,10 +18,12 @@ package env
 
 import (
 	"os"
+	"os/exec"
 	"strings"
 	"testing"
 
 	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/shell"
 )
 
 func TestExpandEnvVar(t *testing.T) {
@@ -50,6 +52,11 @@ func TestExpandEnvVar(t *testing.T) {
 			input:    "$PATH:$PROJECT_ROOT/bin",
 			expected: "/usr/bin:/bin:/test/project/bin",
 		},
+		{
+			name:     "PROJECT_ROOT prefix of longer name",
+			input:    "$PROJECT_ROOT_DIR",
+			expected: "",
+		},
 		{
 			name:     "no expansion needed",
 			input:    "/absolute/path",
@@ -59,7 +66,10 @@ func TestExpandEnvVar(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := expandEnvVar(tt.input, baseDir)
+			result, err := expandEnvVar(tt.input, &Context{Dir: baseDir})
+			if err != nil {
+				t.Fatalf("expandEnvVar() error: %v", err)
+			}
 			if result != tt.expected {
 				t.Errorf("expandEnvVar() = %v, want %v", result, tt.expected)
 			}
@@ -102,27 +112,6 @@ func TestApplyConfig(t *testing.T) {
 	}
 }
 
-func TestShellQuote(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected string
-	}{
-		{"simple", "'simple'"},
-		{"with spaces", "'with spaces'"},
-		{"with'quote", "'with'\"'\"'quote'"},
-		{"", "''"},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			result := shellQuote(tt.input)
-			if result != tt.expected {
-				t.Errorf("shellQuote(%q) = %q, want %q", tt.input, result, tt.expected)
-			}
-		})
-	}
-}
-
 func TestExportForShell(t *testing.T) {
 	cfg := &config.Config{
 		Environment: map[string]string{
@@ -137,7 +126,10 @@ func TestExportForShell(t *testing.T) {
 		},
 	}
 
-	result := ExportForShell(cfg, "/project", "bash")
+	result, err := ExportForShell(cfg, "/project", shell.DialectFor(shell.Bash))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
 
 	if !strings.Contains(result, "export TEST_VAR='value'") {
 		t.Error("Expected export TEST_VAR='value' in output")
@@ -151,3 +143,170 @@ func TestExportForShell(t *testing.T) {
 		t.Error("Expected build function definition in output")
 	}
 }
+
+func TestExportForFish(t *testing.T) {
+	cfg := &config.Config{
+		Environment: map[string]string{
+			"TEST_VAR": "it's",
+			"PATH":     "/test/bin:/usr/bin",
+		},
+		Aliases: map[string]string{
+			"ll": "ls -la",
+		},
+		Scripts: map[string]string{
+			"build": "echo Building...",
+		},
+	}
+
+	result, err := ExportForShell(cfg, "/project", shell.DialectFor(shell.Fish))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
+
+	for _, want := range []string{
+		`set -gx TEST_VAR 'it\'s'`,
+		"set -gx PATH '/test/bin' '/usr/bin'",
+		"alias ll 'ls -la'",
+		"function build --description 'direnv script build'\n    direnv run 'build' $argv\nend",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q in output, got: %s", want, result)
+		}
+	}
+	if strings.Contains(result, "build() {") || strings.Contains(result, "export ") {
+		t.Errorf("Expected no POSIX syntax in fish output, got: %s", result)
+	}
+}
+
+func TestScriptShell(t *testing.T) {
+	t.Setenv("SHELL", "/usr/bin/fish")
+	if shell := scriptShell(); shell != "/bin/sh" {
+		t.Errorf("Expected fish to fall back to /bin/sh, got %s", shell)
+	}
+	t.Setenv("SHELL", "/bin/bash")
+	if shell := scriptShell(); shell != "/bin/bash" {
+		t.Errorf("Expected /bin/bash, got %s", shell)
+	}
+}
+
+func TestExportForPowerShell(t *testing.T) {
+	cfg := &config.Config{
+		Environment: map[string]string{"TEST_VAR": "it's"},
+		Aliases:     map[string]string{"ll": "ls -la"},
+		Scripts:     map[string]string{"build": "make"},
+	}
+
+	result, err := ExportForShell(cfg, "/project", shell.DialectFor(shell.PowerShell))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
+	for _, want := range []string{
+		"$env:TEST_VAR = 'it''s'",
+		"function global:ll {\n    & sh -c 'ls -la \"$@\"' 'll' @args\n}",
+		"function global:build {\n    & direnv run 'build' @args\n}",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q in output, got: %s", want, result)
+		}
+	}
+
+	state := &State{
+		Environment: map[string]string{"EDITOR": "vi"},
+		Applied:     []string{"EDITOR", "TEST_VAR"},
+		Aliases:     map[string]string{"ll": "ls -la"},
+		Functions:   []string{"build"},
+	}
+	result = UnloadForShell(state, shell.DialectFor(shell.PowerShell))
+	for _, want := range []string{
+		"$env:EDITOR = 'vi'",
+		"Remove-Item Env:TEST_VAR -ErrorAction SilentlyContinue",
+		"Remove-Item Function:ll -ErrorAction SilentlyContinue",
+		"Remove-Item Function:build -ErrorAction SilentlyContinue",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q in unload output, got: %s", want, result)
+		}
+	}
+}
+
+func TestExportForPosixShell(t *testing.T) {
+	cfg := &config.Config{
+		Environment: map[string]string{"GREETING": "it's here"},
+		Aliases:     map[string]string{"ll": "ls -la"},
+		Scripts: map[string]string{
+			"build":       `echo "build $*"`,
+			"deploy-prod": `echo "deploy from $PROJECT_ROOT: $1"`,
+		},
+	}
+	dir := t.TempDir()
+
+	result, err := ExportForShell(cfg, dir, shell.DialectFor(shell.Posix))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
+	if strings.Contains(result, "local ") || strings.Contains(result, "deploy-prod()") {
+		t.Errorf("Expected POSIX-only output, got: %s", result)
+	}
+	if !strings.Contains(result, "alias deploy-prod=_direnv_script_deploy_prod") {
+		t.Errorf("Expected an alias for the hyphenated script, got: %s", result)
+	}
+
+	state := &State{}
+	RecordApplied(state, cfg, dir)
+	unload := UnloadForShell(state, shell.DialectFor(shell.Posix))
+	if !strings.Contains(unload, "unset -f _direnv_script_deploy_prod\nunalias deploy-prod") {
+		t.Errorf("Expected the hyphenated script to be removed, got: %s", unload)
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	for name, code := range map[string]string{"export": result, "unload": unload} {
+		if output, err := exec.Command(sh, "-n", "-c", code).CombinedOutput(); err != nil {
+			t.Errorf("sh -n rejected the %s code: %v\n%s", name, err, output)
+		}
+	}
+
+	// Aliases only apply to lines read after they're defined, as in an
+	// interactive shell evaluating the apply
+	output, err := exec.Command(sh, "-c", result+"\neval 'deploy-prod staging; build a b'").CombinedOutput()
+	if err != nil {
+		t.Fatalf("Running the export failed: %v\n%s", err, output)
+	}
+	want := "deploy from " + dir + ": staging\nbuild a b\n"
+	if string(output) != want {
+		t.Errorf("Expected %q, got %q", want, output)
+	}
+}
+
+func TestExportForTcsh(t *testing.T) {
+	cfg := &config.Config{
+		Environment: map[string]string{"GREETING": "hi!"},
+		Aliases:     map[string]string{"ll": "ls -la"},
+		Scripts:     map[string]string{"build": "make"},
+	}
+
+	result, err := ExportForShell(cfg, "/project", shell.DialectFor(shell.Tcsh))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
+	for _, want := range []string{
+		`setenv GREETING 'hi\!'`,
+		"alias ll 'ls -la'",
+		`alias build 'direnv run build \!*'`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q in output, got: %s", want, result)
+		}
+	}
+
+	state := &State{}
+	RecordApplied(state, cfg, "/project")
+	result = UnloadForShell(state, shell.DialectFor(shell.Tcsh))
+	for _, want := range []string{"unsetenv GREETING", "unalias ll", "unalias build"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q in unload output, got: %s", want, result)
+		}
+	}
+}
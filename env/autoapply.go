@@ -0,0 +1,66 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"os"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+// AutoApplyVar turns auto-apply on (1) or off (0) for a shell session or a
+// single command, over all other choices.
+const AutoApplyVar = "DIRENV_AUTO_APPLY"
+
+// AutoApply is the decision whether to apply a project automatically.
+type AutoApply struct {
+	Enabled bool
+	// Source explains which choice decided
+	Source string
+}
+
+// DecideAutoApply decides whether the project of cfg, found from dir,
+// applies automatically. The first choice that was made wins:
+//
+//  1. DIRENV_AUTO_APPLY set to 1 or 0
+//  2. direnv enable/disable --here, for dir or its nearest parent
+//  3. direnv enable/disable, globally
+//  4. auto_apply = true in the project's config
+//
+// Without any, auto-apply is off. cfg may be nil outside a project.
+func DecideAutoApply(dir string, cfg *config.Config, settings *config.Settings) AutoApply {
+	switch os.Getenv(AutoApplyVar) {
+	case "1":
+		return AutoApply{true, AutoApplyVar + "=1"}
+	case "0":
+		return AutoApply{false, AutoApplyVar + "=0"}
+	}
+
+	if settings != nil {
+		if enabled, from, ok := settings.DirectoryAutoApply(dir); ok {
+			return AutoApply{enabled, "setting for " + from}
+		}
+		if settings.AutoApply != nil {
+			return AutoApply{*settings.AutoApply, "global setting"}
+		}
+	}
+
+	if cfg != nil && cfg.AutoApply {
+		return AutoApply{true, "auto_apply in the project config"}
+	}
+	return AutoApply{false, "default"}
+}
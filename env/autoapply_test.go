@@ -0,0 +1,59 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"testing"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+func TestDecideAutoApply(t *testing.T) {
+	on, off := true, false
+	project := &config.Config{AutoApply: true}
+
+	tests := []struct {
+		name     string
+		envValue string
+		settings *config.Settings
+		cfg      *config.Config
+		want     AutoApply
+	}{
+		{"default", "", &config.Settings{}, &config.Config{}, AutoApply{false, "default"}},
+		{"outside a project", "", nil, nil, AutoApply{false, "default"}},
+		{"project config", "", &config.Settings{}, project, AutoApply{true, "auto_apply in the project config"}},
+		{"global over project", "", &config.Settings{AutoApply: &off}, project, AutoApply{false, "global setting"}},
+		{"directory over global", "", &config.Settings{
+			AutoApply:   &off,
+			Directories: map[string]bool{"/work": true},
+		}, nil, AutoApply{true, "setting for /work"}},
+		{"variable over directory", "0", &config.Settings{
+			Directories: map[string]bool{"/work/app": true},
+		}, project, AutoApply{false, "DIRENV_AUTO_APPLY=0"}},
+		{"variable enables", "1", &config.Settings{AutoApply: &off}, nil, AutoApply{true, "DIRENV_AUTO_APPLY=1"}},
+		{"other variable values are ignored", "yes", &config.Settings{AutoApply: &on}, nil, AutoApply{true, "global setting"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(AutoApplyVar, tt.envValue)
+			if got := DecideAutoApply("/work/app", tt.cfg, tt.settings); got != tt.want {
+				t.Errorf("DecideAutoApply() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -23,32 +23,42 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
 )
 
+// cacheMaxAge is how long cleanup keeps a cached source result.
+const cacheMaxAge = 7 * 24 * time.Hour
+
 func CleanupOrphanedState() error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+	// Find all state_*.json and session_*.json files in ~/.config/direnv/
+	configDir := stateDir
+	var matches []string
+	for _, prefix := range []string{"state_", "session_"} {
+		found, err := filepath.Glob(filepath.Join(configDir, prefix+"*.json"))
+		if err != nil {
+			return fmt.Errorf("failed to find state files: %w", err)
+		}
+		matches = append(matches, found...)
 	}
-
-	// Find all state_*.json files in ~/.config/direnv/
-	configDir := filepath.Join(homeDir, ".config", "direnv")
-	pattern := filepath.Join(configDir, "state_*.json")
-	matches, err := filepath.Glob(pattern)
+	// nu shells keep the commands of their project in defs_<pid>.nu, see
+	// shell.NushellDefsDir
+	defs, err := filepath.Glob(filepath.Join(configDir, "nushell", "defs_*.nu"))
 	if err != nil {
-		return fmt.Errorf("failed to find state files: %w", err)
+		return fmt.Errorf("failed to find nushell defs files: %w", err)
 	}
+	matches = append(matches, defs...)
 
 	cleaned := 0
 	for _, stateFile := range matches {
-		// Extract PID from filename (state_<PID>.json)
+		// Extract PID from filename (state_<session>.json,
+		// session_<session>.json, where the session ID starts with the PID,
+		// or defs_<pid>.nu)
 		base := filepath.Base(stateFile)
-		if !strings.HasPrefix(base, "state_") || !strings.HasSuffix(base, ".json") {
-			continue
-		}
-
-		pidStr := strings.TrimPrefix(base, "state_")
-		pidStr = strings.TrimSuffix(pidStr, ".json")
+		pidStr := strings.TrimSuffix(base, filepath.Ext(base))
+		pidStr = pidStr[strings.Index(pidStr, "_")+1:]
+		pidStr, _, _ = strings.Cut(pidStr, "-")
 
 		pid, err := strconv.Atoi(pidStr)
 		if err != nil {
@@ -69,6 +79,15 @@ func CleanupOrphanedState() error {
 	if cleaned > 0 {
 		fmt.Printf("Cleaned up %d orphaned state file(s)\n", cleaned)
 	}
+	if jobs := cleanupJobs(); jobs > 0 {
+		fmt.Printf("Cleaned up %d finished job(s)\n", jobs)
+	}
+	if projects := cleanupServices(); projects > 0 {
+		fmt.Printf("Stopped services of %d project(s) with no open shells\n", projects)
+	}
+	if entries := config.PruneCache(cacheMaxAge); entries > 0 {
+		fmt.Printf("Removed %d stale cached source result(s)\n", entries)
+	}
 
 	return nil
 }
@@ -81,8 +100,17 @@ func isProcessRunning(pid int) bool {
 		return false
 	}
 
-	err = process.Signal(syscall.Signal(0))
-	return err == nil
+	if err := process.Signal(syscall.Signal(0)); err != nil {
+		return false
+	}
+
+	// A zombie still accepts signals but has exited; /proc tells on Linux
+	if stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		if i := strings.LastIndexByte(string(stat), ')'); i >= 0 && i+2 < len(stat) && stat[i+2] == 'Z' {
+			return false
+		}
+	}
+	return true
 }
 
 func GetActiveEnvironmentInfo() (string, bool) {
@@ -17,9 +17,12 @@
 package env
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/TierOne-Software/direnv/config"
 )
 
 func TestCleanupOrphanedState(t *testing.T) {
@@ -59,3 +62,32 @@ func TestGetActiveEnvironmentInfo(t *testing.T) {
 	// Test would require setting up state file with known PID,
 	// which is complex in a test environment
 }
+
+func TestCleanupRemovesNushellDefsOfClosedShells(t *testing.T) {
+	useTempStateDir(t)
+	originalCacheDir := config.CacheDir
+	config.CacheDir = t.TempDir()
+	t.Cleanup(func() { config.CacheDir = originalCacheDir })
+
+	defsDir := filepath.Join(stateDir, "nushell")
+	if err := os.MkdirAll(defsDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	closed := filepath.Join(defsDir, "defs_99999999.nu")
+	open := filepath.Join(defsDir, fmt.Sprintf("defs_%d.nu", os.Getpid()))
+	for _, file := range []string{closed, open} {
+		if err := os.WriteFile(file, []byte("def build [] { }\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CleanupOrphanedState(); err != nil {
+		t.Fatalf("CleanupOrphanedState failed: %v", err)
+	}
+	if _, err := os.Stat(closed); !os.IsNotExist(err) {
+		t.Error("Expected the defs of a closed shell to be removed")
+	}
+	if _, err := os.Stat(open); err != nil {
+		t.Errorf("Expected the defs of a running shell to be kept: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+// Built-in variables, available in expansion and exported on apply.
+const (
+	VarDir     = "DIRENV_DIR"
+	VarFile    = "DIRENV_FILE"
+	VarProfile = "DIRENV_PROFILE"
+	VarProject = "DIRENV_PROJECT"
+	VarGitRoot = "GIT_ROOT"
+	VarLayers  = "DIRENV_LAYERS"
+)
+
+// DefaultProfile is used when DIRENV_PROFILE is not set before applying.
+const DefaultProfile = "default"
+
+// Context describes the project an environment is built for.
+type Context struct {
+	Dir     string   // directory containing the config, also $PROJECT_ROOT
+	File    string   // the main config file
+	Profile string   // DIRENV_PROFILE from the environment, or "default"
+	Project string   // config name, or the directory name
+	GitRoot string   // enclosing git work tree, if any
+	Layers  []string // config files that were merged, base first
+}
+
+// NewContext builds the context for cfg loaded from baseDir.
+func NewContext(cfg *config.Config, baseDir string) *Context {
+	ctx := &Context{
+		Dir:     baseDir,
+		File:    filepath.Join(baseDir, config.ConfigFileName),
+		Profile: os.Getenv(VarProfile),
+		Project: cfg.Name,
+		GitRoot: findGitRoot(baseDir),
+		Layers:  cfg.Layers,
+	}
+
+	if len(ctx.Layers) > 0 {
+		ctx.File = ctx.Layers[0]
+	} else {
+		ctx.Layers = []string{ctx.File}
+	}
+	if ctx.Profile == "" {
+		ctx.Profile = DefaultProfile
+	}
+	if ctx.Project == "" {
+		ctx.Project = filepath.Base(baseDir)
+	}
+
+	return ctx
+}
+
+// Builtins returns the built-in variables to export. GIT_ROOT is omitted
+// outside a git work tree.
+func (c *Context) Builtins() map[string]string {
+	vars := map[string]string{
+		VarDir:     c.Dir,
+		VarFile:    c.File,
+		VarProfile: c.Profile,
+		VarProject: c.Project,
+		VarLayers:  strings.Join(c.Layers, string(os.PathListSeparator)),
+	}
+	if c.GitRoot != "" {
+		vars[VarGitRoot] = c.GitRoot
+	}
+	return vars
+}
+
+// lookup resolves a name during expansion: built-ins and $PROJECT_ROOT
+// first, then the process environment.
+func (c *Context) lookup(name string) (string, bool) {
+	if name == "PROJECT_ROOT" {
+		return c.Dir, true
+	}
+	if value, ok := c.Builtins()[name]; ok {
+		return value, true
+	}
+	return os.LookupEnv(name)
+}
+
+// IsBuiltin reports whether name is reserved for a built-in variable.
+func IsBuiltin(name string) bool {
+	switch name {
+	case VarDir, VarFile, VarProfile, VarProject, VarGitRoot, VarLayers:
+		return true
+	}
+	return false
+}
+
+func findGitRoot(dir string) string {
+	for {
+		// .git is a directory in a normal checkout and a file in worktrees
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/shell"
+)
+
+func TestNewContext(t *testing.T) {
+	tmpDir := t.TempDir()
+	projectDir := filepath.Join(tmpDir, "myproject")
+	if err := os.MkdirAll(filepath.Join(tmpDir, ".git"), 0755); err != nil {
+		t.Fatalf("Failed to create .git: %v", err)
+	}
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	os.Unsetenv(VarProfile)
+
+	ctx := NewContext(&config.Config{}, projectDir)
+	vars := ctx.Builtins()
+
+	expected := map[string]string{
+		VarDir:     projectDir,
+		VarFile:    filepath.Join(projectDir, config.ConfigFileName),
+		VarProfile: DefaultProfile,
+		VarProject: "myproject",
+		VarGitRoot: tmpDir,
+		VarLayers:  filepath.Join(projectDir, config.ConfigFileName),
+	}
+	for key, want := range expected {
+		if vars[key] != want {
+			t.Errorf("%s = %q, want %q", key, vars[key], want)
+		}
+	}
+
+	t.Setenv(VarProfile, "ci")
+	cfg := &config.Config{
+		Name:   "named",
+		Layers: []string{"/p/.direnv.toml", "/p/.direnv.local.toml"},
+	}
+	vars = NewContext(cfg, "/p").Builtins()
+	if vars[VarProject] != "named" {
+		t.Errorf("Expected project name from config, got %q", vars[VarProject])
+	}
+	if vars[VarProfile] != "ci" {
+		t.Errorf("Expected profile from environment, got %q", vars[VarProfile])
+	}
+	if vars[VarLayers] != "/p/.direnv.toml"+string(os.PathListSeparator)+"/p/.direnv.local.toml" {
+		t.Errorf("Unexpected layers %q", vars[VarLayers])
+	}
+	if _, exists := vars[VarGitRoot]; exists {
+		t.Error("Expected GIT_ROOT to be omitted outside a git work tree")
+	}
+}
+
+func TestExportForShellBuiltins(t *testing.T) {
+	cfg := &config.Config{
+		Name: "demo",
+		Environment: map[string]string{
+			"BUILD_DIR":      "$DIRENV_DIR/build",
+			"DIRENV_PROJECT": "ignored",
+		},
+	}
+
+	result, err := ExportForShell(cfg, "/project", shell.DialectFor(shell.Bash))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"export BUILD_DIR='/project/build'",
+		"export DIRENV_DIR='/project'",
+		"export DIRENV_PROJECT='demo'",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q in output, got: %s", want, result)
+		}
+	}
+}
+
+func TestUnloadForShell(t *testing.T) {
+	state := &State{
+		Environment: map[string]string{"PATH": "/usr/bin"},
+		Applied:     []string{"PATH", "DIRENV_DIR"},
+		Aliases:     map[string]string{"ll": "ls -la"},
+		Functions:   []string{"build"},
+	}
+
+	result := UnloadForShell(state, shell.DialectFor(shell.Bash))
+	for _, want := range []string{
+		"export PATH='/usr/bin'",
+		"unset DIRENV_DIR",
+		"unalias ll",
+		"unset -f build",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q in unload output, got: %s", want, result)
+		}
+	}
+
+	result = UnloadForShell(state, shell.DialectFor(shell.Fish))
+	for _, want := range []string{
+		"set -gx PATH '/usr/bin'",
+		"set -e DIRENV_DIR",
+		"functions -e ll",
+		"functions -e build",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q in fish unload output, got: %s", want, result)
+		}
+	}
+}
+
+func TestRecordApplied(t *testing.T) {
+	cfg := &config.Config{
+		Environment: map[string]string{"CC": "gcc"},
+		Sources:     map[string]config.Source{"SHA": {Command: "true"}},
+		Aliases:     map[string]string{"ll": "ls -la"},
+		Scripts:     map[string]string{"build": "make"},
+	}
+
+	state := &State{}
+	RecordApplied(state, cfg, "/project")
+
+	applied := strings.Join(state.Applied, ",")
+	for _, key := range []string{"CC", "SHA", VarDir, VarProject} {
+		if !strings.Contains(applied, key) {
+			t.Errorf("Expected %s to be recorded as applied, got %v", key, state.Applied)
+		}
+	}
+	if _, exists := state.Aliases["ll"]; !exists {
+		t.Error("Expected alias ll to be recorded")
+	}
+	if len(state.Functions) != 1 || state.Functions[0] != "build" {
+		t.Errorf("Expected function build to be recorded, got %v", state.Functions)
+	}
+}
@@ -39,6 +39,7 @@ type EnvDiff struct {
 	OldValue string
 	NewValue string
 	Type     DiffType
+	Origin   string // hook that set the value, if any
 }
 
 type AliasDiff struct {
@@ -58,6 +59,7 @@ type ConfigDiff struct {
 	Environment []EnvDiff
 	Aliases     []AliasDiff
 	Scripts     []ScriptDiff
+	Warnings    []string
 }
 
 func GenerateDiff(cfg *config.Config, baseDir string) (*ConfigDiff, error) {
@@ -72,12 +74,42 @@ func GenerateDiff(cfg *config.Config, baseDir string) (*ConfigDiff, error) {
 		}
 	}
 
+	warnings, err := CheckExpansion(cfg, baseDir)
+	if err != nil {
+		return nil, err
+	}
+	diff.Warnings = warnings
+
+	ctx := NewContext(cfg, baseDir)
+
 	// Compare environment variables
 	targetEnv := make(map[string]string)
+	for key, value := range ctx.Builtins() {
+		targetEnv[key] = value
+	}
 	for key, value := range cfg.Environment {
-		expandedValue := expandEnvVar(value, baseDir)
+		if IsBuiltin(key) {
+			continue
+		}
+		expandedValue, err := environmentValue(cfg, ctx, key, value)
+		if err != nil {
+			return nil, err
+		}
 		targetEnv[key] = expandedValue
 	}
+	origins := make(map[string]string)
+	for key, src := range cfg.Sources {
+		if IsBuiltin(key) {
+			continue
+		}
+		if src.Hook != "" {
+			origins[key] = src.Hook
+			targetEnv[key] = src.Value
+		} else {
+			// Never decrypt or run sources just to show a diff
+			targetEnv[key] = "<" + src.Kind() + ">"
+		}
+	}
 
 	// Find all environment keys
 	allEnvKeys := make(map[string]bool)
@@ -98,6 +130,7 @@ func GenerateDiff(cfg *config.Config, baseDir string) (*ConfigDiff, error) {
 				Key:      key,
 				NewValue: targetVal,
 				Type:     Added,
+				Origin:   origins[key],
 			})
 		} else if hasCurrentVal && hasTargetVal && currentVal != targetVal {
 			diff.Environment = append(diff.Environment, EnvDiff{
@@ -105,6 +138,7 @@ func GenerateDiff(cfg *config.Config, baseDir string) (*ConfigDiff, error) {
 				OldValue: currentVal,
 				NewValue: targetVal,
 				Type:     Modified,
+				Origin:   origins[key],
 			})
 		}
 		// Skip showing removals for now since they're mostly system vars
@@ -148,14 +182,21 @@ func (d *ConfigDiff) Format() string {
 	if len(d.Environment) > 0 {
 		output = append(output, "Environment variables:")
 		for _, envDiff := range d.Environment {
+			var line string
 			switch envDiff.Type {
 			case Added:
-				output = append(output, fmt.Sprintf("  + %s=%s", envDiff.Key, envDiff.NewValue))
+				line = fmt.Sprintf("  + %s=%s", envDiff.Key, envDiff.NewValue)
 			case Modified:
-				output = append(output, fmt.Sprintf("  ~ %s=%s → %s", envDiff.Key, envDiff.OldValue, envDiff.NewValue))
+				line = fmt.Sprintf("  ~ %s=%s → %s", envDiff.Key, envDiff.OldValue, envDiff.NewValue)
 			case Removed:
-				output = append(output, fmt.Sprintf("  - %s=%s", envDiff.Key, envDiff.OldValue))
+				line = fmt.Sprintf("  - %s=%s", envDiff.Key, envDiff.OldValue)
+			default:
+				continue
 			}
+			if envDiff.Origin != "" {
+				line += fmt.Sprintf("  (from %s)", envDiff.Origin)
+			}
+			output = append(output, line)
 		}
 		output = append(output, "")
 	}
@@ -181,6 +222,16 @@ func (d *ConfigDiff) Format() string {
 		}
 	}
 
+	if len(d.Warnings) > 0 {
+		if len(output) > 0 && output[len(output)-1] != "" {
+			output = append(output, "")
+		}
+		output = append(output, "Warnings:")
+		for _, warning := range d.Warnings {
+			output = append(output, fmt.Sprintf("  ! %s", warning))
+		}
+	}
+
 	if len(output) == 0 {
 		return "No changes would be made.\n"
 	}
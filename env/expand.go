@@ -0,0 +1,293 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+// expander implements the subset of shell parameter expansion supported in
+// config values:
+//
+//	$VAR, ${VAR}      value of VAR
+//	${VAR:-default}   default if VAR is unset or empty (${VAR-default}: unset only)
+//	${VAR:=default}   same as :- (config values can't assign)
+//	${VAR:?message}   error if VAR is unset or empty
+//	${VAR:+alt}       alt if VAR is set and non-empty
+//	$$                a literal $
+//	~/ at the start   the user's home directory
+//
+// Names are looked up in the built-ins of the Context first, then in the
+// process environment.
+// Defaults and alternatives are expanded recursively. References to
+// undefined variables expand to "" and are recorded in undefined.
+type expander struct {
+	lookup    func(name string) (string, bool)
+	undefined []string
+}
+
+func (e *expander) expand(s string) (string, error) {
+	if s == "~" || strings.HasPrefix(s, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			s = home + s[1:]
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		next := s[i+1]
+		switch {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := matchingBrace(s, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", s)
+			}
+			value, err := e.expandBraced(s[i+2 : end])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			i = end
+		case isNameStart(next):
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			b.WriteString(e.get(s[i+1 : j]))
+			i = j - 1
+		default:
+			// Not a reference, e.g. "$1" or "cost: $5"
+			b.WriteByte('$')
+		}
+	}
+
+	return b.String(), nil
+}
+
+func (e *expander) expandBraced(expr string) (string, error) {
+	j := 0
+	for j < len(expr) && isNameChar(expr[j]) {
+		j++
+	}
+	name := expr[:j]
+	if name == "" || !isNameStart(name[0]) {
+		return "", fmt.Errorf("bad substitution: ${%s}", expr)
+	}
+	if j == len(expr) {
+		return e.get(name), nil
+	}
+
+	rest := expr[j:]
+	checkEmpty := strings.HasPrefix(rest, ":")
+	if checkEmpty {
+		rest = rest[1:]
+	}
+	if rest == "" {
+		return "", fmt.Errorf("bad substitution: ${%s}", expr)
+	}
+	op, word := rest[0], rest[1:]
+
+	value, isSet := e.lookup(name)
+	present := isSet && (!checkEmpty || value != "")
+
+	switch op {
+	case '-', '=':
+		if present {
+			return value, nil
+		}
+		return e.expand(word)
+	case '+':
+		if present {
+			return e.expand(word)
+		}
+		return "", nil
+	case '?':
+		if present {
+			return value, nil
+		}
+		message, err := e.expand(word)
+		if err != nil {
+			return "", err
+		}
+		if message == "" {
+			message = "parameter null or not set"
+		}
+		return "", fmt.Errorf("%s: %s", name, message)
+	default:
+		return "", fmt.Errorf("bad substitution: ${%s}", expr)
+	}
+}
+
+func (e *expander) get(name string) string {
+	value, ok := e.lookup(name)
+	if !ok {
+		e.undefined = append(e.undefined, name)
+	}
+	return value
+}
+
+// matchingBrace returns the index of the } closing the { at open, allowing
+// nested ${...} in defaults.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// isValidName reports whether s is a valid shell variable name.
+func isValidName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// expandValue expands a config value against ctx and also returns the
+// names of any undefined variables it referenced.
+func expandValue(value string, ctx *Context) (string, []string, error) {
+	e := &expander{lookup: ctx.lookup}
+	result, err := e.expand(value)
+	return result, e.undefined, err
+}
+
+// ExpandAlias returns the alias command, expanded if the config opts in
+// with expand_aliases.
+func ExpandAlias(cfg *config.Config, command, baseDir string) (string, error) {
+	return expandAlias(cfg, NewContext(cfg, baseDir), command)
+}
+
+// ExpandHook returns the hook body, expanded if the config opts in with
+// expand_hooks.
+func ExpandHook(cfg *config.Config, body, baseDir string) (string, error) {
+	return expandHook(cfg, NewContext(cfg, baseDir), body)
+}
+
+func expandAlias(cfg *config.Config, ctx *Context, command string) (string, error) {
+	if !cfg.ExpandAliases {
+		return command, nil
+	}
+	result, _, err := expandValue(command, ctx)
+	return result, err
+}
+
+func expandHook(cfg *config.Config, ctx *Context, body string) (string, error) {
+	if !cfg.ExpandHooks || body == "" {
+		return body, nil
+	}
+	result, _, err := expandValue(body, ctx)
+	return result, err
+}
+
+// CheckExpansion expands every value the config would expand and reports
+// references to undefined variables as warnings, ignoring variables the
+// config itself defines. Hard failures such as
+// ${VAR:?message} are returned as the error.
+func CheckExpansion(cfg *config.Config, baseDir string) ([]string, error) {
+	var warnings []string
+	ctx := NewContext(cfg, baseDir)
+
+	// name is the template name of the value, or "" if it can't be a
+	// template. Rendered values aren't expanded.
+	check := func(what, name, value string) error {
+		if name != "" && isTemplate(cfg, value) {
+			_, err := renderConfigValue(cfg, ctx, name, value)
+			return err
+		}
+		_, undefined, err := expandValue(value, ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", what, err)
+		}
+		for _, name := range undefined {
+			if _, defined := cfg.Environment[name]; defined {
+				continue
+			}
+			if _, defined := cfg.Sources[name]; defined {
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("%s references undefined variable $%s", what, name))
+		}
+		return nil
+	}
+
+	for key, value := range cfg.Environment {
+		if err := check(key, "environment."+key, value); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ExpandAliases {
+		for name, command := range cfg.Aliases {
+			if err := check("alias "+name, "aliases."+name, command); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if cfg.ExpandHooks {
+		for name, hook := range map[string]config.Hook{
+			HookPreApply:       cfg.Hooks.PreApply,
+			HookPostApply:      cfg.Hooks.PostApply,
+			HookOnLeave:        cfg.Hooks.OnLeave,
+			HookOnEnter:        cfg.Hooks.OnEnter,
+			HookOnEnterSubdir:  cfg.Hooks.OnEnterSubdir,
+			HookOnConfigChange: cfg.Hooks.OnConfigChange,
+			HookPreRun:         cfg.Hooks.PreRun,
+			HookPostRun:        cfg.Hooks.PostRun,
+		} {
+			if err := check("hook "+name, "", hook.Run); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Strings(warnings)
+	return warnings, nil
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/shell"
+)
+
+func TestExpandValue(t *testing.T) {
+	t.Setenv("SET_VAR", "value")
+	t.Setenv("EMPTY_VAR", "")
+	os.Unsetenv("UNSET_VAR")
+	homeDir, _ := os.UserHomeDir()
+
+	tests := []struct {
+		name      string
+		input     string
+		expected  string
+		undefined []string
+	}{
+		{"braced", "${SET_VAR}/x", "value/x", nil},
+		{"default when unset", "${UNSET_VAR:-fallback}", "fallback", nil},
+		{"default when empty", "${EMPTY_VAR:-fallback}", "fallback", nil},
+		{"no-colon default keeps empty", "${EMPTY_VAR-fallback}", "", nil},
+		{"default not used", "${SET_VAR:-fallback}", "value", nil},
+		{"nested default", "${UNSET_VAR:-$SET_VAR/bin}", "value/bin", nil},
+		{"alternative when set", "${SET_VAR:+--flag}", "--flag", nil},
+		{"alternative when unset", "${UNSET_VAR:+--flag}", "", nil},
+		{"escaped dollar", "cost: $$5 and $$SET_VAR", "cost: $5 and $SET_VAR", nil},
+		{"positional left alone", "echo $1", "echo $1", nil},
+		{"trailing dollar", "50$", "50$", nil},
+		{"tilde", "~/bin", homeDir + "/bin", nil},
+		{"tilde not leading", "a:~/bin", "a:~/bin", nil},
+		{"project root", "$PROJECT_ROOT/bin", "/project/bin", nil},
+		{"project root prefix", "${PROJECT_ROOT_DIR:-none}", "none", nil},
+		{"undefined reported", "$UNSET_VAR:${UNSET_VAR}", ":", []string{"UNSET_VAR", "UNSET_VAR"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, undefined, err := expandValue(tt.input, &Context{Dir: "/project"})
+			if err != nil {
+				t.Fatalf("expandValue(%q) error: %v", tt.input, err)
+			}
+			if result != tt.expected {
+				t.Errorf("expandValue(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+			if !reflect.DeepEqual(undefined, tt.undefined) {
+				t.Errorf("expandValue(%q) undefined = %v, want %v", tt.input, undefined, tt.undefined)
+			}
+		})
+	}
+}
+
+func TestExpandValueErrors(t *testing.T) {
+	os.Unsetenv("UNSET_VAR")
+
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{"${UNSET_VAR:?must be set}", "UNSET_VAR: must be set"},
+		{"${UNSET_VAR:?}", "UNSET_VAR: parameter null or not set"},
+		{"${UNSET_VAR", "unterminated"},
+		{"${1abc}", "bad substitution"},
+		{"${UNSET_VAR%x}", "bad substitution"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, _, err := expandValue(tt.input, &Context{Dir: "/project"})
+			if err == nil {
+				t.Fatalf("Expected error for %q", tt.input)
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing %q, got: %v", tt.contains, err)
+			}
+		})
+	}
+}
+
+func TestCheckExpansion(t *testing.T) {
+	os.Unsetenv("UNSET_VAR")
+
+	cfg := &config.Config{
+		Environment: map[string]string{
+			"A": "$UNSET_VAR/bin",
+			"B": "$A/lib", // defined by the config itself
+		},
+		Aliases: map[string]string{
+			"run": "$UNSET_VAR",
+		},
+	}
+
+	warnings, err := CheckExpansion(cfg, "/project")
+	if err != nil {
+		t.Fatalf("CheckExpansion failed: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "A references undefined variable $UNSET_VAR") {
+		t.Errorf("Expected a single warning for A, got %v", warnings)
+	}
+
+	cfg.ExpandAliases = true
+	warnings, err = CheckExpansion(cfg, "/project")
+	if err != nil {
+		t.Fatalf("CheckExpansion failed: %v", err)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("Expected alias to be checked once opted in, got %v", warnings)
+	}
+}
+
+func TestExportForShellExpansionOptIn(t *testing.T) {
+	t.Setenv("SET_VAR", "value")
+
+	cfg := &config.Config{
+		Aliases: map[string]string{"show": "echo $SET_VAR"},
+	}
+
+	result, err := ExportForShell(cfg, "/project", shell.DialectFor(shell.Bash))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
+	if !strings.Contains(result, "alias show='echo $SET_VAR'") {
+		t.Errorf("Expected alias to be left unexpanded by default, got: %s", result)
+	}
+
+	cfg.ExpandAliases = true
+	result, err = ExportForShell(cfg, "/project", shell.DialectFor(shell.Bash))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
+	if !strings.Contains(result, "alias show='echo value'") {
+		t.Errorf("Expected alias to be expanded when opted in, got: %s", result)
+	}
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+// HookOnChange is the name on_change hooks report in diagnostics.
+const HookOnChange = "on_change"
+
+// ChangeRecord is what direnv remembers about the last successful run of
+// an on_change hook.
+type ChangeRecord struct {
+	Files       []string  `json:"files"`
+	Run         string    `json:"run"`
+	Fingerprint string    `json:"fingerprint"`
+	LastRun     time.Time `json:"last_run"`
+}
+
+// ChangeStatus describes an on_change hook of the current config.
+type ChangeStatus struct {
+	Hook        config.ChangeHook
+	Fingerprint string        // fingerprint of the files now
+	Record      *ChangeRecord // last successful run, nil if never run
+	// Running is set while an async run for the current files is running
+	Running bool
+}
+
+// Pending reports whether the hook would run on the next apply.
+func (s ChangeStatus) Pending() bool {
+	return !s.Running && (s.Record == nil || s.Record.Fingerprint != s.Fingerprint)
+}
+
+// changeRecords are stored per project, keyed by changeHookKey.
+type changeRecords struct {
+	Directory string                  `json:"directory"`
+	Hooks     map[string]ChangeRecord `json:"hooks"`
+	// Jobs are the async runs whose outcome isn't known yet
+	Jobs map[string]changeJob `json:"jobs,omitempty"`
+}
+
+// changeJob is an async run of an on_change hook. Its record becomes the
+// last successful run once the job exits 0.
+type changeJob struct {
+	Job    string       `json:"job"`
+	Record ChangeRecord `json:"record"`
+}
+
+// FingerprintsDir holds the on_change records, one file per project.
+func FingerprintsDir() string {
+	return filepath.Join(stateDir, "fingerprints")
+}
+
+func fingerprintsFile(baseDir string) string {
+	return filepath.Join(FingerprintsDir(), projectKey(baseDir)+".json")
+}
+
+// projectKey names per-project files in the state directory.
+func projectKey(dir string) string {
+	sum := sha256.Sum256([]byte(dir))
+	return hex.EncodeToString(sum[:8])
+}
+
+// changeHookKey identifies a hook by what it watches and runs, so editing
+// either makes it run again.
+func changeHookKey(hook config.ChangeHook) string {
+	h := sha256.New()
+	for _, file := range hook.Files {
+		fmt.Fprintf(h, "file:%s\x00", file)
+	}
+	fmt.Fprintf(h, "run:%s", hook.Run)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprintFiles hashes the contents of files relative to baseDir. A
+// missing file hashes differently from an empty one.
+func fingerprintFiles(baseDir string, files []string) (string, error) {
+	h := sha256.New()
+	for _, file := range files {
+		path := file
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		data, err := os.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+			fmt.Fprintf(h, "%s\x00missing\x00", file)
+		case err != nil:
+			return "", fmt.Errorf("failed to read %s: %w", file, err)
+		default:
+			sum := sha256.Sum256(data)
+			fmt.Fprintf(h, "%s\x00%x\x00", file, sum)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func loadChangeRecords(baseDir string) (*changeRecords, error) {
+	records := &changeRecords{
+		Directory: baseDir,
+		Hooks:     make(map[string]ChangeRecord),
+		Jobs:      make(map[string]changeJob),
+	}
+
+	data, err := os.ReadFile(fingerprintsFile(baseDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, fmt.Errorf("failed to read fingerprints: %w", err)
+	}
+	if err := json.Unmarshal(data, records); err != nil {
+		return nil, fmt.Errorf("failed to parse fingerprints: %w", err)
+	}
+	if records.Hooks == nil {
+		records.Hooks = make(map[string]ChangeRecord)
+	}
+	if records.Jobs == nil {
+		records.Jobs = make(map[string]changeJob)
+	}
+	return records, nil
+}
+
+func saveChangeRecords(records *changeRecords) error {
+	if err := os.MkdirAll(FingerprintsDir(), 0700); err != nil {
+		return fmt.Errorf("failed to create fingerprints directory: %w", err)
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal fingerprints: %w", err)
+	}
+	if err := os.WriteFile(fingerprintsFile(records.Directory), data, 0600); err != nil {
+		return fmt.Errorf("failed to write fingerprints: %w", err)
+	}
+	return nil
+}
+
+// ChangeHookStatus reports, for each on_change hook of cfg, the current
+// fingerprint of its files and its last successful run.
+func ChangeHookStatus(cfg *config.Config, baseDir string) ([]ChangeStatus, error) {
+	records, err := loadChangeRecords(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	settleChangeJobs(records)
+	return changeStatuses(cfg, baseDir, records)
+}
+
+func changeStatuses(cfg *config.Config, baseDir string, records *changeRecords) ([]ChangeStatus, error) {
+	statuses := make([]ChangeStatus, 0, len(cfg.Hooks.OnChange))
+	for _, hook := range cfg.Hooks.OnChange {
+		fingerprint, err := fingerprintFiles(baseDir, hook.Files)
+		if err != nil {
+			return nil, err
+		}
+		status := ChangeStatus{Hook: hook, Fingerprint: fingerprint}
+		key := changeHookKey(hook)
+		if record, ok := records.Hooks[key]; ok {
+			status.Record = &record
+		}
+		if job, ok := records.Jobs[key]; ok && job.Record.Fingerprint == fingerprint {
+			status.Running = true
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// settleChangeJobs records the async runs that exited 0 as successful and
+// forgets those that failed or were cancelled, so they run again. It
+// reports whether records changed.
+func settleChangeJobs(records *changeRecords) bool {
+	changed := false
+	for key, pending := range records.Jobs {
+		job, err := loadJob(pending.Job)
+		if err == nil {
+			status := job.Status()
+			if status.Running {
+				continue
+			}
+			if status.ExitCode == 0 {
+				records.Hooks[key] = pending.Record
+			}
+		}
+		delete(records.Jobs, key)
+		changed = true
+	}
+	return changed
+}
+
+// RunChangeHooks runs the on_change hooks of cfg whose files changed since
+// they last succeeded. A failed hook keeps its old fingerprint, so it is
+// retried on the next apply; an async hook's fingerprint is recorded once
+// its job exits 0. on_change hooks warn on failure by default.
+func RunChangeHooks(cfg *config.Config, baseDir string) error {
+	records, err := loadChangeRecords(baseDir)
+	if err != nil {
+		return err
+	}
+	changed := settleChangeJobs(records)
+	statuses, err := changeStatuses(cfg, baseDir, records)
+	if err != nil {
+		return err
+	}
+
+	ctx := NewContext(cfg, baseDir)
+	extraEnv := make([]string, 0)
+	for key, value := range ctx.Builtins() {
+		extraEnv = append(extraEnv, key+"="+value)
+	}
+
+	var errs []error
+	for _, status := range statuses {
+		if !status.Pending() {
+			continue
+		}
+
+		hook := status.Hook.Hook()
+		if hook.Run, err = expandHook(cfg, ctx, hook.Run); err != nil {
+			errs = append(errs, &HookError{Hook: HookOnChange, Abort: hook.Aborts(config.OnFailureWarn), Err: err})
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "direnv: %s changed, running %s\n", strings.Join(status.Hook.Files, ", "), status.Hook.Run)
+
+		key := changeHookKey(status.Hook)
+		record := ChangeRecord{
+			Files:       status.Hook.Files,
+			Run:         status.Hook.Run,
+			Fingerprint: status.Fingerprint,
+			LastRun:     time.Now(),
+		}
+		if hook.Async {
+			job, err := StartJob(HookOnChange, hook, baseDir, extraEnv)
+			if err != nil {
+				errs = append(errs, &HookError{Hook: HookOnChange, Err: err})
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "direnv: started %s hook in the background (job %s)\n", HookOnChange, job.ID)
+			records.Jobs[key] = changeJob{Job: job.ID, Record: record}
+			changed = true
+			continue
+		}
+		if _, err := RunHook(HookOnChange, hook, baseDir, extraEnv); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		records.Hooks[key] = record
+		changed = true
+	}
+
+	if changed {
+		if err := saveChangeRecords(records); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
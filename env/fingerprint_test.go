@@ -0,0 +1,184 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+func TestRunChangeHooksOncePerChange(t *testing.T) {
+	useTempStateDir(t)
+	t.Setenv("SHELL", "/bin/sh")
+	dir := t.TempDir()
+
+	lockFile := filepath.Join(dir, "package-lock.json")
+	if err := os.WriteFile(lockFile, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Hooks: config.Hooks{
+			OnChange: []config.ChangeHook{{
+				Files: []string{"package-lock.json"},
+				Run:   "echo run >> runs.txt",
+			}},
+		},
+	}
+
+	runs := func() int {
+		data, _ := os.ReadFile(filepath.Join(dir, "runs.txt"))
+		return strings.Count(string(data), "run")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := RunChangeHooks(cfg, dir); err != nil {
+			t.Fatalf("RunChangeHooks failed: %v", err)
+		}
+	}
+	if runs() != 1 {
+		t.Errorf("Expected hook to run once for unchanged files, ran %d times", runs())
+	}
+
+	statuses, err := ChangeHookStatus(cfg, dir)
+	if err != nil {
+		t.Fatalf("ChangeHookStatus failed: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Record == nil || statuses[0].Pending() {
+		t.Errorf("Expected up-to-date status after run, got %+v", statuses)
+	}
+
+	if err := os.WriteFile(lockFile, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	statuses, _ = ChangeHookStatus(cfg, dir)
+	if !statuses[0].Pending() {
+		t.Error("Expected hook to be pending after its file changed")
+	}
+	if err := RunChangeHooks(cfg, dir); err != nil {
+		t.Fatalf("RunChangeHooks failed: %v", err)
+	}
+	if runs() != 2 {
+		t.Errorf("Expected hook to run again after change, ran %d times", runs())
+	}
+}
+
+func TestRunChangeHooksRetriesFailures(t *testing.T) {
+	useTempStateDir(t)
+	t.Setenv("SHELL", "/bin/sh")
+	dir := t.TempDir()
+
+	cfg := &config.Config{
+		Hooks: config.Hooks{
+			OnChange: []config.ChangeHook{{
+				Files: []string{"go.sum"},
+				Run:   "echo run >> runs.txt; exit 1",
+			}},
+		},
+	}
+
+	err := RunChangeHooks(cfg, dir)
+	if err == nil {
+		t.Fatal("Expected failing hook to return an error")
+	}
+	if IsAbort(err) {
+		t.Error("Expected on_change hooks to warn by default")
+	}
+
+	statuses, _ := ChangeHookStatus(cfg, dir)
+	if statuses[0].Record != nil || !statuses[0].Pending() {
+		t.Error("Expected failed hook to stay pending")
+	}
+}
+
+func TestRunChangeHooksRecordsAsyncJobResult(t *testing.T) {
+	useTempStateDir(t)
+	t.Setenv("SHELL", "/bin/sh")
+	dir := t.TempDir()
+
+	cfg := &config.Config{
+		Hooks: config.Hooks{
+			OnChange: []config.ChangeHook{{
+				Files: []string{"go.sum"},
+				Run:   "echo run >> runs.txt; test -f ok",
+				Async: true,
+			}},
+		},
+	}
+	runs := func() int {
+		data, _ := os.ReadFile(filepath.Join(dir, "runs.txt"))
+		return strings.Count(string(data), "run")
+	}
+	waitForJobs := func() {
+		t.Helper()
+		jobs, err := ListJobs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, status := range jobs {
+			waitForJob(t, status.Job, func(s JobStatus) bool { return !s.Running })
+		}
+	}
+
+	if err := RunChangeHooks(cfg, dir); err != nil {
+		t.Fatalf("RunChangeHooks failed: %v", err)
+	}
+	statuses, _ := ChangeHookStatus(cfg, dir)
+	if statuses[0].Record != nil {
+		t.Error("Expected async hook not to be recorded before its job exits")
+	}
+	waitForJobs()
+
+	// The job failed, so the hook is retried
+	statuses, _ = ChangeHookStatus(cfg, dir)
+	if statuses[0].Record != nil || !statuses[0].Pending() {
+		t.Error("Expected failed async hook to stay pending")
+	}
+	if err := RunChangeHooks(cfg, dir); err != nil {
+		t.Fatalf("RunChangeHooks failed: %v", err)
+	}
+	waitForJobs()
+	if runs() != 2 {
+		t.Fatalf("Expected failed async hook to run again, ran %d times", runs())
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "ok"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunChangeHooks(cfg, dir); err != nil {
+		t.Fatalf("RunChangeHooks failed: %v", err)
+	}
+	waitForJobs()
+
+	// The job succeeded, so its fingerprint is recorded
+	statuses, _ = ChangeHookStatus(cfg, dir)
+	if statuses[0].Record == nil || statuses[0].Pending() {
+		t.Error("Expected succeeded async hook to be recorded")
+	}
+	if err := RunChangeHooks(cfg, dir); err != nil {
+		t.Fatalf("RunChangeHooks failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if runs() != 3 {
+		t.Errorf("Expected recorded async hook not to run again, ran %d times", runs())
+	}
+}
@@ -0,0 +1,291 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/shell"
+)
+
+// Hook names, as used in config files and diagnostics.
+const (
+	HookPreApply       = "pre_apply"
+	HookPostApply      = "post_apply"
+	HookOnLeave        = "on_leave"
+	HookOnEnter        = "on_enter"
+	HookOnEnterSubdir  = "on_enter_subdir"
+	HookOnConfigChange = "on_config_change"
+	HookPreRun         = "pre_run"
+	HookPostRun        = "post_run"
+)
+
+// Variables passed to hooks.
+const (
+	// VarEnvFile names the file hooks write KEY=VALUE lines to in order to
+	// add variables to the applied environment.
+	VarEnvFile = "DIRENV_ENV_FILE"
+	// VarScript and VarExitCode tell pre_run and post_run which script ran
+	// and how it exited.
+	VarScript   = "DIRENV_SCRIPT"
+	VarExitCode = "DIRENV_EXIT_CODE"
+)
+
+// HookValue is a variable a hook added to the environment.
+type HookValue struct {
+	Hook  string `json:"hook"`
+	Value string `json:"value"`
+}
+
+// HookError reports a failed hook. Abort is set when the hook's failure
+// policy says the surrounding operation must not continue.
+type HookError struct {
+	Hook   string
+	Abort  bool
+	Output string
+	Err    error
+}
+
+func (e *HookError) Error() string {
+	msg := fmt.Sprintf("%s hook failed: %v", e.Hook, e.Err)
+	if e.Output != "" {
+		msg += "\n" + indent(e.Output, "  ")
+	}
+	return msg
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// IsAbort reports whether err is a hook failure that should abort.
+func IsAbort(err error) bool {
+	var hookErr *HookError
+	return errors.As(err, &hookErr) && hookErr.Abort
+}
+
+// defaultPolicy is the failure policy used when a hook sets no on_failure:
+// only the hooks that run before an apply or a script stop it by default.
+func defaultPolicy(name string) string {
+	switch name {
+	case HookPreApply, HookPreRun:
+		return config.OnFailureAbort
+	}
+	return config.OnFailureWarn
+}
+
+// configHook returns the hook of cfg with the given name.
+func configHook(cfg *config.Config, name string) (config.Hook, error) {
+	switch name {
+	case HookPreApply:
+		return cfg.Hooks.PreApply, nil
+	case HookPostApply:
+		return cfg.Hooks.PostApply, nil
+	case HookOnLeave:
+		return cfg.Hooks.OnLeave, nil
+	case HookOnEnter:
+		return cfg.Hooks.OnEnter, nil
+	case HookOnEnterSubdir:
+		return cfg.Hooks.OnEnterSubdir, nil
+	case HookOnConfigChange:
+		return cfg.Hooks.OnConfigChange, nil
+	case HookPreRun:
+		return cfg.Hooks.PreRun, nil
+	case HookPostRun:
+		return cfg.Hooks.PostRun, nil
+	}
+	return config.Hook{}, fmt.Errorf("unknown hook '%s'", name)
+}
+
+// RunConfigHook runs an apply-time hook of cfg and returns the variables it
+// wrote to $DIRENV_ENV_FILE. post_apply sees the full environment the apply
+// exports; the other hooks see the built-in variables.
+func RunConfigHook(cfg *config.Config, name string, baseDir string) (map[string]string, error) {
+	ctx := NewContext(cfg, baseDir)
+
+	values := ctx.Builtins()
+	if name == HookPostApply && cfg.Hooks.PostApply.IsSet() {
+		var err error
+		if values, err = buildEnvironment(cfg, ctx); err != nil {
+			return nil, &HookError{Hook: name, Abort: cfg.Hooks.PostApply.Aborts(defaultPolicy(name)), Err: err}
+		}
+	}
+
+	extraEnv := make([]string, 0, len(values))
+	for key, value := range values {
+		extraEnv = append(extraEnv, key+"="+value)
+	}
+	return runConfigHook(cfg, ctx, name, baseDir, extraEnv)
+}
+
+// runConfigHook expands and runs the named hook of cfg with extraEnv.
+func runConfigHook(cfg *config.Config, ctx *Context, name string, baseDir string, extraEnv []string) (map[string]string, error) {
+	hook, err := configHook(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	if !hook.IsSet() {
+		return nil, nil
+	}
+
+	body, err := expandHook(cfg, ctx, hook.Run)
+	if err != nil {
+		return nil, &HookError{Hook: name, Abort: hook.Aborts(defaultPolicy(name)), Err: err}
+	}
+	hook.Run = body
+
+	return RunHook(name, hook, baseDir, extraEnv)
+}
+
+// RunHook runs hook in baseDir under its timeout and returns the variables
+// it wrote to $DIRENV_ENV_FILE. Async hooks are started as a job instead and
+// contribute no variables. Its output is captured so it never reaches
+// the shell evaluating direnv's stdout: it is copied to stderr on success
+// and included in the returned *HookError on failure.
+func RunHook(name string, hook config.Hook, baseDir string, extraEnv []string) (map[string]string, error) {
+	if !hook.IsSet() {
+		return nil, nil
+	}
+	if hook.Async {
+		job, err := StartJob(name, hook, baseDir, extraEnv)
+		if err != nil {
+			return nil, &HookError{Hook: name, Err: err}
+		}
+		fmt.Fprintf(os.Stderr, "direnv: started %s hook in the background (job %s)\n", name, job.ID)
+		return nil, nil
+	}
+
+	shellPath := scriptShell()
+
+	envFile, err := os.CreateTemp("", "direnv-env-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hook env file: %w", err)
+	}
+	envFile.Close()
+	defer os.Remove(envFile.Name())
+
+	timeout := hook.TimeoutDuration()
+	runCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(runCtx, shellPath, "-c", hook.Run)
+	cmd.Dir = baseDir
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.Env = append(os.Environ(), extraEnv...)
+	cmd.Env = append(cmd.Env,
+		"PROJECT_ROOT="+baseDir,
+		"PWD="+baseDir,
+		VarEnvFile+"="+envFile.Name(),
+	)
+	killGroupOnCancel(cmd)
+	// Don't wait for children that keep the output pipe open after a kill
+	cmd.WaitDelay = 100 * time.Millisecond
+
+	err = cmd.Run()
+	captured := strings.TrimRight(output.String(), "\n")
+	if err != nil {
+		if runCtx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		return nil, &HookError{
+			Hook:   name,
+			Abort:  hook.Aborts(defaultPolicy(name)),
+			Output: captured,
+			Err:    err,
+		}
+	}
+	if captured != "" {
+		fmt.Fprintln(os.Stderr, captured)
+	}
+
+	data, err := os.ReadFile(envFile.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hook env file: %w", err)
+	}
+	values, err := parseEnvFile(string(data))
+	if err != nil {
+		return nil, &HookError{Hook: name, Abort: hook.Aborts(defaultPolicy(name)), Err: err}
+	}
+	return values, nil
+}
+
+// parseEnvFile reads KEY=VALUE lines. Values are taken verbatim up to the
+// end of the line; blank lines and lines starting with # are skipped.
+func parseEnvFile(data string) (map[string]string, error) {
+	values := make(map[string]string)
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || !isValidName(key) {
+			return nil, fmt.Errorf("%s line %d: expected KEY=VALUE, got %q", VarEnvFile, i+1, line)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// MergeHookValues adds variables set by hook to cfg. They replace config
+// entries of the same name, like a local override would.
+func MergeHookValues(cfg *config.Config, hook string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	if cfg.Sources == nil {
+		cfg.Sources = make(map[string]config.Source)
+	}
+	for key, value := range values {
+		cfg.Sources[key] = config.Source{Hook: hook, Value: value}
+		delete(cfg.Environment, key)
+	}
+}
+
+// MergeSavedHookValues adds the hook variables recorded in state to cfg, so
+// a diff shows them without running the hooks again.
+func MergeSavedHookValues(cfg *config.Config, state *State) {
+	for key, hv := range state.HookEnvironment {
+		MergeHookValues(cfg, hv.Hook, map[string]string{key: hv.Value})
+	}
+}
+
+// ExportVariables returns shell code exporting values, sorted by name.
+func ExportVariables(values map[string]string, d shell.Dialect) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, d.SetVar(key, values[key]))
+	}
+	return strings.Join(lines, "\n")
+}
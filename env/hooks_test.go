@@ -0,0 +1,327 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/shell"
+)
+
+func TestRunHookSuccess(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	dir := t.TempDir()
+
+	hook := config.Hook{Run: "pwd > out.txt"}
+	if _, err := RunHook(HookPostApply, hook, dir, nil); err != nil {
+		t.Fatalf("RunHook failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatalf("Expected hook to run in base dir: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != dir {
+		t.Errorf("Expected hook to run in %s, got %s", dir, got)
+	}
+}
+
+func TestRunHookFailurePolicy(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	dir := t.TempDir()
+
+	tests := []struct {
+		name      string
+		hookName  string
+		hook      config.Hook
+		wantAbort bool
+	}{
+		{"pre_apply aborts by default", HookPreApply, config.Hook{Run: "echo broken; exit 1"}, true},
+		{"post_apply warns by default", HookPostApply, config.Hook{Run: "echo broken; exit 1"}, false},
+		{"on_leave warns by default", HookOnLeave, config.Hook{Run: "echo broken; exit 1"}, false},
+		{"explicit warn", HookPreApply, config.Hook{Run: "echo broken; exit 1", OnFailure: config.OnFailureWarn}, false},
+		{"explicit abort", HookPostApply, config.Hook{Run: "echo broken; exit 1", OnFailure: config.OnFailureAbort}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RunHook(tt.hookName, tt.hook, dir, nil)
+			if err == nil {
+				t.Fatal("Expected hook to fail")
+			}
+			if IsAbort(err) != tt.wantAbort {
+				t.Errorf("IsAbort() = %v, want %v", IsAbort(err), tt.wantAbort)
+			}
+			if !strings.Contains(err.Error(), "broken") {
+				t.Errorf("Expected captured output in error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunHookTimeout(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+
+	start := time.Now()
+	_, err := RunHook(HookPreApply, config.Hook{Run: "sleep 5", Timeout: "100ms"}, t.TempDir(), nil)
+	if err == nil {
+		t.Fatal("Expected timeout error")
+	}
+	if !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected timeout error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Hook was not stopped at its timeout, took %v", elapsed)
+	}
+}
+
+func TestRunHookTimeoutKillsChildren(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks need /bin/sh")
+	}
+	t.Setenv("SHELL", "/bin/sh")
+	dir := t.TempDir()
+
+	_, err := RunHook(HookPreApply, config.Hook{Run: "sleep 30 & echo $! > child.pid; wait", Timeout: "200ms"}, dir, nil)
+	if err == nil {
+		t.Fatal("Expected timeout error")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "child.pid"))
+	if err != nil {
+		t.Fatalf("Failed to read child PID: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("Invalid child PID %q", data)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for isProcessRunning(pid) {
+		if time.Now().After(deadline) {
+			if process, err := os.FindProcess(pid); err == nil {
+				process.Kill()
+			}
+			t.Fatal("Expected the hook's children to be killed at its timeout")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRunConfigHookEnvironment(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	dir := t.TempDir()
+
+	cfg := &config.Config{
+		Environment: map[string]string{"APP_MODE": "dev"},
+		Hooks: config.Hooks{
+			PreApply:  config.Hook{Run: `echo "${APP_MODE:-unset} $DIRENV_DIR" > pre.txt`},
+			PostApply: config.Hook{Run: `echo "${APP_MODE:-unset} $DIRENV_DIR" > post.txt`},
+		},
+	}
+
+	for _, name := range []string{HookPreApply, HookPostApply} {
+		if _, err := RunConfigHook(cfg, name, dir); err != nil {
+			t.Fatalf("RunConfigHook(%s) failed: %v", name, err)
+		}
+	}
+
+	pre, _ := os.ReadFile(filepath.Join(dir, "pre.txt"))
+	if got := strings.TrimSpace(string(pre)); got != "unset "+dir {
+		t.Errorf("Expected pre_apply to see only built-ins, got %q", got)
+	}
+	post, _ := os.ReadFile(filepath.Join(dir, "post.txt"))
+	if got := strings.TrimSpace(string(post)); got != "dev "+dir {
+		t.Errorf("Expected post_apply to see the applied environment, got %q", got)
+	}
+}
+
+func TestExportForShellOmitsHooks(t *testing.T) {
+	cfg := &config.Config{
+		Environment: map[string]string{"A": "1"},
+		Hooks: config.Hooks{
+			PreApply:  config.Hook{Run: "echo pre-hook-body"},
+			PostApply: config.Hook{Run: "echo post-hook-body"},
+		},
+	}
+
+	result, err := ExportForShell(cfg, "/project", shell.DialectFor(shell.Bash))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
+	if strings.Contains(result, "hook-body") {
+		t.Errorf("Expected hooks to stay out of the eval'd output, got: %s", result)
+	}
+}
+
+func TestRunHookEnvFile(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+
+	hook := config.Hook{Run: `
+echo "KUBECONFIG=$PROJECT_ROOT/.kube/config" >> "$DIRENV_ENV_FILE"
+echo "# comment" >> "$DIRENV_ENV_FILE"
+echo "TOKEN=a=b c" >> "$DIRENV_ENV_FILE"
+`}
+	dir := t.TempDir()
+	values, err := RunHook(HookPreApply, hook, dir, nil)
+	if err != nil {
+		t.Fatalf("RunHook failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"KUBECONFIG": dir + "/.kube/config",
+		"TOKEN":      "a=b c",
+	}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, values)
+	}
+	for key, want := range expected {
+		if values[key] != want {
+			t.Errorf("%s = %q, want %q", key, values[key], want)
+		}
+	}
+
+	_, err = RunHook(HookPreApply, config.Hook{Run: `echo "not a pair" >> "$DIRENV_ENV_FILE"`}, dir, nil)
+	if err == nil || !IsAbort(err) {
+		t.Errorf("Expected malformed env file to fail the hook, got %v", err)
+	}
+}
+
+func TestHookValuesApplied(t *testing.T) {
+	cfg := &config.Config{
+		Environment: map[string]string{"TOKEN": "config", "OTHER": "1"},
+	}
+	MergeHookValues(cfg, HookPreApply, map[string]string{"TOKEN": "from-hook", "TEST_KUBECONFIG": "/tmp/kube"})
+
+	result, err := ExportForShell(cfg, "/project", shell.DialectFor(shell.Bash))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
+	for _, want := range []string{"export TOKEN='from-hook'", "export TEST_KUBECONFIG='/tmp/kube'", "export OTHER='1'"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q in output, got: %s", want, result)
+		}
+	}
+	if strings.Contains(result, "'config'") {
+		t.Errorf("Expected hook value to replace config value, got: %s", result)
+	}
+
+	state := &State{Environment: map[string]string{}}
+	RecordApplied(state, cfg, "/project")
+	if state.HookEnvironment["TEST_KUBECONFIG"] != (HookValue{Hook: HookPreApply, Value: "/tmp/kube"}) {
+		t.Errorf("Expected hook value recorded in state, got %v", state.HookEnvironment)
+	}
+	unload := UnloadForShell(state, shell.DialectFor(shell.Bash))
+	if !strings.Contains(unload, "unset TEST_KUBECONFIG") {
+		t.Errorf("Expected hook value to be unloaded, got: %s", unload)
+	}
+
+	fresh := &config.Config{Environment: map[string]string{"OTHER": "1"}}
+	MergeSavedHookValues(fresh, state)
+	diff, err := GenerateDiff(fresh, "/project")
+	if err != nil {
+		t.Fatalf("GenerateDiff failed: %v", err)
+	}
+	if !strings.Contains(diff.Format(), "+ TEST_KUBECONFIG=/tmp/kube  (from pre_apply)") {
+		t.Errorf("Expected hook value in diff, got:\n%s", diff.Format())
+	}
+}
+
+func TestExecuteConfigScriptRunHooks(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	dir := t.TempDir()
+
+	cfg := &config.Config{
+		Scripts: map[string]string{
+			"ok":   "true",
+			"fail": "exit 3",
+		},
+		Hooks: config.Hooks{
+			PreRun:  config.Hook{Run: `echo "pre $DIRENV_SCRIPT" >> log.txt`},
+			PostRun: config.Hook{Run: `echo "post $DIRENV_SCRIPT $DIRENV_EXIT_CODE" >> log.txt`},
+		},
+	}
+
+	if err := ExecuteConfigScript(cfg, "ok", dir); err != nil {
+		t.Fatalf("ExecuteConfigScript failed: %v", err)
+	}
+	if err := ExecuteConfigScript(cfg, "fail", dir); err == nil {
+		t.Fatal("Expected failing script to return an error")
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "log.txt"))
+	expected := "pre ok\npost ok 0\npre fail\npost fail 3\n"
+	if string(data) != expected {
+		t.Errorf("Expected hook log %q, got %q", expected, string(data))
+	}
+
+	cfg.Hooks.PreRun = config.Hook{Run: "exit 1"}
+	cfg.Scripts["ok"] = "echo ran >> ran.txt"
+	if err := ExecuteConfigScript(cfg, "ok", dir); err == nil || !IsAbort(err) {
+		t.Errorf("Expected failing pre_run to abort, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran.txt")); err == nil {
+		t.Error("Expected script not to run after pre_run failed")
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	cfg := &config.Config{
+		Environment: map[string]string{"A": "1", "B": "2"},
+		Sources:     map[string]config.Source{"C": {Command: "date", Value: "today"}},
+	}
+	hash := ConfigHash(cfg)
+
+	same := &config.Config{
+		Environment: map[string]string{"B": "2", "A": "1"},
+		Sources:     map[string]config.Source{"C": {Command: "date", Value: "tomorrow"}},
+	}
+	MergeHookValues(same, HookPreApply, map[string]string{"TOKEN": "x"})
+	if ConfigHash(same) != hash {
+		t.Error("Expected resolved values and hook variables not to affect the hash")
+	}
+
+	cfg.Environment["A"] = "changed"
+	if ConfigHash(cfg) == hash {
+		t.Error("Expected a changed definition to change the hash")
+	}
+}
+
+func TestEnteredInSession(t *testing.T) {
+	useTempStateDir(t)
+	t.Setenv("DIRENV_SHELL_PID", "424242")
+
+	entered, err := EnteredInSession("/project")
+	if err != nil || entered {
+		t.Fatalf("Expected fresh session, got %v, %v", entered, err)
+	}
+	if err := RecordEntered("/project"); err != nil {
+		t.Fatalf("RecordEntered failed: %v", err)
+	}
+	if entered, _ := EnteredInSession("/project"); !entered {
+		t.Error("Expected project to be recorded as entered")
+	}
+	if entered, _ := EnteredInSession("/other"); entered {
+		t.Error("Expected other projects to be unaffected")
+	}
+}
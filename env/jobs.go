@@ -0,0 +1,262 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+// Job is an async hook running, or having run, in the background.
+type Job struct {
+	ID           string    `json:"id"`
+	Hook         string    `json:"hook"`
+	Run          string    `json:"run"`
+	Directory    string    `json:"directory"`
+	PID          int       `json:"pid"`
+	ProcessStart string    `json:"process_start,omitempty"` // start time of PID, to detect its reuse
+	Session      string    `json:"session"`                 // shell session that started the job
+	Started      time.Time `json:"started"`
+	Cancelled    bool      `json:"cancelled,omitempty"`
+}
+
+// JobStatus is the state of a job as observed now.
+type JobStatus struct {
+	Job
+	Running  bool
+	ExitCode int // -1 unless the job finished on its own
+}
+
+// String describes the status in a few words.
+func (s JobStatus) String() string {
+	switch {
+	case s.Running:
+		return "running"
+	case s.ExitCode >= 0:
+		return fmt.Sprintf("exited %d", s.ExitCode)
+	case s.Cancelled:
+		return "cancelled"
+	default:
+		return "killed"
+	}
+}
+
+// JobsDir holds a metadata, log and exit status file per job.
+func JobsDir() string {
+	return filepath.Join(stateDir, "jobs")
+}
+
+func jobFile(id, ext string) string {
+	return filepath.Join(JobsDir(), id+ext)
+}
+
+// LogFile returns the path of the job's captured output.
+func (j Job) LogFile() string {
+	return jobFile(j.ID, ".log")
+}
+
+// StartJob launches hook detached from direnv and the shell, with its
+// output going to the job's log file. A wrapper shell records the exit
+// status, so it can be reported after direnv has exited.
+func StartJob(name string, hook config.Hook, baseDir string, extraEnv []string) (*Job, error) {
+	if err := os.MkdirAll(JobsDir(), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create jobs directory: %w", err)
+	}
+
+	shell := scriptShell()
+
+	job := &Job{
+		ID:        fmt.Sprintf("%s-%d", strings.ReplaceAll(name, "_", "-"), time.Now().UnixNano()),
+		Hook:      name,
+		Run:       hook.Run,
+		Directory: baseDir,
+		Session:   currentSession(),
+		Started:   time.Now(),
+	}
+
+	log, err := os.OpenFile(job.LogFile(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job log: %w", err)
+	}
+	defer log.Close()
+
+	// $0 is the user's shell, $1 the hook body and $2 the exit status file
+	cmd := exec.Command("/bin/sh", "-c", `"$0" -c "$1"; echo $? > "$2"`, shell, hook.Run, jobFile(job.ID, ".exit"))
+	cmd.Dir = baseDir
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.Env = append(os.Environ(), extraEnv...)
+	cmd.Env = append(cmd.Env,
+		"PROJECT_ROOT="+baseDir,
+		"PWD="+baseDir,
+	)
+	detach(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s hook: %w", name, err)
+	}
+	job.PID = cmd.Process.Pid
+	job.ProcessStart = processStart(job.PID)
+	// Reap the wrapper should it finish while direnv is still running
+	go cmd.Wait()
+
+	if err := saveJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func saveJob(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	if err := os.WriteFile(jobFile(job.ID, ".json"), data, 0600); err != nil {
+		return fmt.Errorf("failed to write job: %w", err)
+	}
+	return nil
+}
+
+func loadJob(id string) (*Job, error) {
+	data, err := os.ReadFile(jobFile(id, ".json"))
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to parse job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// Status reports whether the job is still running and how it exited.
+func (j Job) Status() JobStatus {
+	status := JobStatus{Job: j, ExitCode: -1}
+	if data, err := os.ReadFile(jobFile(j.ID, ".exit")); err == nil {
+		if code, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			status.ExitCode = code
+			return status
+		}
+	}
+	status.Running = isProcess(j.PID, j.ProcessStart)
+	return status
+}
+
+// ListJobs returns every recorded job, oldest first.
+func ListJobs() ([]JobStatus, error) {
+	matches, err := filepath.Glob(jobFile("*", ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find jobs: %w", err)
+	}
+
+	jobs := make([]JobStatus, 0, len(matches))
+	for _, match := range matches {
+		job, err := loadJob(strings.TrimSuffix(filepath.Base(match), ".json"))
+		if err != nil {
+			continue // skip jobs removed or written concurrently
+		}
+		jobs = append(jobs, job.Status())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Started.Before(jobs[j].Started)
+	})
+	return jobs, nil
+}
+
+// RunningJobs returns the jobs this shell session started for directory
+// that are still running.
+func RunningJobs(directory string) ([]Job, error) {
+	jobs, err := ListJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	session := currentSession()
+	var running []Job
+	for _, job := range jobs {
+		if job.Session == session && job.Directory == directory && job.Running {
+			running = append(running, job.Job)
+		}
+	}
+	return running, nil
+}
+
+// CancelJobs stops the jobs recorded in state that are still running.
+func CancelJobs(state *State) error {
+	var errs []error
+	for _, recorded := range state.Jobs {
+		job, err := loadJob(recorded.ID)
+		if err != nil {
+			// The record is gone; fall back to what the state knows
+			job = &recorded
+		}
+		if !job.Status().Running {
+			continue
+		}
+		if err := killJob(job.PID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to cancel job %s: %w", job.ID, err))
+			continue
+		}
+		job.Cancelled = true
+		if err := saveJob(job); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	state.Jobs = nil
+	return errors.Join(errs...)
+}
+
+// cleanupJobs removes the records of finished jobs whose shell session
+// has ended and returns how many were removed.
+func cleanupJobs() int {
+	jobs, err := ListJobs()
+	if err != nil {
+		return 0
+	}
+
+	cleaned := 0
+	for _, job := range jobs {
+		if job.Running || sessionAlive(job.Session) {
+			continue
+		}
+		for _, ext := range []string{".json", ".log", ".exit"} {
+			os.Remove(jobFile(job.ID, ext))
+		}
+		cleaned++
+	}
+	return cleaned
+}
+
+// isProcess reports whether pid still runs the process recorded with the
+// given start time, rather than one that reused the PID. Records written
+// before start times were kept only have the PID to go by.
+func isProcess(pid int, start string) bool {
+	if !isProcessRunning(pid) {
+		return false
+	}
+	return start == "" || processStart(pid) == start
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+func waitForJob(t *testing.T, job Job, done func(JobStatus) bool) JobStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := job.Status()
+		if done(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job %s did not reach the expected state, last status: %s", job.ID, status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestAsyncHookRunsAsJob(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("jobs need /bin/sh")
+	}
+	useTempStateDir(t)
+	t.Setenv("SHELL", "/bin/sh")
+	t.Setenv("DIRENV_SHELL_PID", "424243")
+	dir := t.TempDir()
+
+	hook := config.Hook{Run: "echo warming; exit 2", Async: true}
+	if _, err := RunHook(HookPostApply, hook, dir, nil); err != nil {
+		t.Fatalf("RunHook failed: %v", err)
+	}
+
+	jobs, err := ListJobs()
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected one job, got %v, %v", jobs, err)
+	}
+	job := jobs[0].Job
+	if job.Hook != HookPostApply || job.Directory != dir || job.Session != "424243" {
+		t.Errorf("Unexpected job record: %+v", job)
+	}
+
+	status := waitForJob(t, job, func(s JobStatus) bool { return !s.Running && s.ExitCode >= 0 })
+	if status.String() != "exited 2" {
+		t.Errorf("Expected job to exit 2, got %s", status)
+	}
+
+	log, err := os.ReadFile(job.LogFile())
+	if err != nil || !strings.Contains(string(log), "warming") {
+		t.Errorf("Expected job output in log, got %q, %v", log, err)
+	}
+}
+
+func TestCancelJobs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("jobs need /bin/sh")
+	}
+	useTempStateDir(t)
+	t.Setenv("SHELL", "/bin/sh")
+	t.Setenv("DIRENV_SHELL_PID", "424244")
+	dir := t.TempDir()
+
+	job, err := StartJob(HookOnEnter, config.Hook{Run: "sleep 30", Async: true}, dir, nil)
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+
+	running, err := RunningJobs(dir)
+	if err != nil || len(running) != 1 || running[0].PID != job.PID {
+		t.Fatalf("Expected the job to be running, got %v, %v", running, err)
+	}
+
+	state := &State{Jobs: running}
+	if err := CancelJobs(state); err != nil {
+		t.Fatalf("CancelJobs failed: %v", err)
+	}
+	if len(state.Jobs) != 0 {
+		t.Error("Expected cancelled jobs to be removed from the state")
+	}
+
+	reloaded, err := loadJob(job.ID)
+	if err != nil {
+		t.Fatalf("loadJob failed: %v", err)
+	}
+	status := waitForJob(t, *reloaded, func(s JobStatus) bool { return !s.Running })
+	if status.String() != "cancelled" {
+		t.Errorf("Expected job to be cancelled, got %s", status)
+	}
+}
+
+func TestCancelJobsSkipsReusedPID(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("jobs need /bin/sh")
+	}
+	useTempStateDir(t)
+
+	// An unrelated process group now holds the PID the job had
+	other := exec.Command("sleep", "30")
+	detach(other)
+	if err := other.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		other.Process.Kill()
+		other.Wait()
+	})
+	if processStart(other.Process.Pid) == "" {
+		t.Fatal("Expected the start time of a running process")
+	}
+
+	job := Job{ID: "on-enter-1", PID: other.Process.Pid, ProcessStart: "1", Started: time.Now()}
+	if job.Status().Running {
+		t.Error("Expected a job whose PID was reused not to be running")
+	}
+
+	if err := CancelJobs(&State{Jobs: []Job{job}}); err != nil {
+		t.Fatalf("CancelJobs failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !isProcessRunning(other.Process.Pid) {
+		t.Error("Expected CancelJobs to leave the process reusing the PID alone")
+	}
+}
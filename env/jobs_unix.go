@@ -0,0 +1,103 @@
+//go:build !windows
+
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// detach starts the job in its own session, so it outlives the shell and
+// can be stopped as a whole process group.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// killJob terminates the job's process group.
+func killJob(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGTERM)
+}
+
+// processStart identifies the process with pid by its start time, so a
+// record can tell its process from a later one reusing the PID. It returns
+// "" if the start time can't be read.
+func processStart(pid int) string {
+	if stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		// The start time is field 22; the command name before the fields may contain spaces
+		if i := bytes.LastIndexByte(stat, ')'); i >= 0 {
+			if fields := strings.Fields(string(stat[i+1:])); len(fields) > 19 {
+				return fields[19]
+			}
+		}
+		return ""
+	}
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// forceKillJob kills the job's process group outright.
+func forceKillJob(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
+
+// jobGroupRunning reports whether any process of the job's group is left.
+func jobGroupRunning(pid int) bool {
+	if syscall.Kill(-pid, 0) != nil {
+		return false
+	}
+
+	// Zombies nobody reaped yet still count as members; /proc tells on Linux
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil || len(stats) == 0 {
+		return true
+	}
+	pgid := strconv.Itoa(pid)
+	for _, path := range stats {
+		stat, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// After the command name come the state and, two fields on, the group
+		if i := bytes.LastIndexByte(stat, ')'); i >= 0 {
+			fields := strings.Fields(string(stat[i+1:]))
+			if len(fields) > 2 && fields[2] == pgid && fields[0] != "Z" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// killGroupOnCancel runs cmd in its own process group and makes cancelling
+// its context kill the whole group, not just the shell it starts.
+func killGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
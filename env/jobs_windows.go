@@ -0,0 +1,73 @@
+//go:build windows
+
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// detach starts the job in its own process group, so console signals for
+// the shell don't reach it.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// killJob terminates the job's wrapper process.
+func killJob(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
+
+// processStart identifies the process with pid by its creation time, so a
+// record can tell its process from a later one reusing the PID. It returns
+// "" if the creation time can't be read.
+func processStart(pid int) string {
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(handle)
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return ""
+	}
+	return strconv.FormatInt(creation.Nanoseconds(), 10)
+}
+
+// forceKillJob kills the job's wrapper process; Windows has no SIGTERM to
+// escalate from.
+func forceKillJob(pid int) error {
+	return killJob(pid)
+}
+
+// jobGroupRunning reports whether the job's wrapper process is left.
+func jobGroupRunning(pid int) bool {
+	return isProcessRunning(pid)
+}
+
+// killGroupOnCancel leaves cmd as is: cancelling its context kills the
+// shell, and Windows has no process group to kill with it.
+func killGroupOnCancel(cmd *exec.Cmd) {}
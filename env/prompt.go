@@ -0,0 +1,133 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+// StaleWarning is the prompt warning for a config edited since it was
+// applied.
+const StaleWarning = "stale config"
+
+// PromptStatus is what direnv prompt shows. It's printed as JSON for
+// prompt frameworks, so fields are only ever added.
+type PromptStatus struct {
+	Active      bool   `json:"active"`
+	Project     string `json:"project"`
+	Profile     string `json:"profile"`
+	Directory   string `json:"directory"`
+	Session     string `json:"session"`
+	AutoApplied bool   `json:"auto_applied"`
+	Stale       bool   `json:"stale"`
+}
+
+// LoadPromptStatus describes the environment applied in this session. It
+// reads only the state file and the modification times of the config
+// files, as it runs for every prompt.
+func LoadPromptStatus() (*PromptStatus, error) {
+	status := InactivePromptStatus()
+
+	state, err := LoadSavedState()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil || state.Directory == "" {
+		return status, nil
+	}
+
+	status.Active = true
+	status.Directory = state.Directory
+	status.Project = state.Project
+	if status.Project == "" {
+		// Applied by a version that didn't record it
+		status.Project = filepath.Base(state.Directory)
+	}
+	status.Profile = state.Profile
+	status.AutoApplied = state.AutoApplied
+	status.Stale = configChangedSince(state)
+	return status, nil
+}
+
+// InactivePromptStatus is the status of this session with no environment
+// applied. It reads no files.
+func InactivePromptStatus() *PromptStatus {
+	return &PromptStatus{Session: currentSession()}
+}
+
+// configChangedSince reports whether a config file of the applied project
+// was edited, removed or, for the local config, added after the apply.
+func configChangedSince(state *State) bool {
+	if state.AppliedAt.IsZero() {
+		return false
+	}
+	files := append([]string{}, state.Layers...)
+	local := filepath.Join(state.Directory, config.LocalConfigFileName)
+	if !slices.Contains(files, local) {
+		if _, err := os.Stat(local); err == nil {
+			files = append(files, local)
+		}
+	}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil || info.ModTime().After(state.AppliedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Warning returns the prompt warning, or "" if there's nothing to warn
+// about.
+func (s *PromptStatus) Warning() string {
+	if s.Stale {
+		return StaleWarning
+	}
+	return ""
+}
+
+// Format renders the status for a prompt. In format, {project},
+// {profile}, {dir} and {warning} are replaced by their values. An empty
+// format gives the project, the profile unless it's the default and the
+// warning in parentheses. Without an applied environment the result is
+// always empty, so the prompt segment disappears.
+func (s *PromptStatus) Format(format string) string {
+	if !s.Active {
+		return ""
+	}
+	if format == "" {
+		segment := s.Project
+		if s.Profile != "" && s.Profile != DefaultProfile {
+			segment += ":" + s.Profile
+		}
+		if warning := s.Warning(); warning != "" {
+			segment += " (" + warning + ")"
+		}
+		return segment
+	}
+	return strings.NewReplacer(
+		"{project}", s.Project,
+		"{profile}", s.Profile,
+		"{dir}", s.Directory,
+		"{warning}", s.Warning(),
+	).Replace(format)
+}
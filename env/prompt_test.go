@@ -0,0 +1,113 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+func TestLoadPromptStatus(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalStateFile := stateFile
+	stateFile = filepath.Join(tmpDir, "test_state.json")
+	defer func() { stateFile = originalStateFile }()
+
+	status, err := LoadPromptStatus()
+	if err != nil {
+		t.Fatalf("Failed to load status without state: %v", err)
+	}
+	if status.Active || status.Format("") != "" {
+		t.Errorf("Expected an inactive status and no segment, got %+v", status)
+	}
+
+	projectDir := filepath.Join(tmpDir, "api")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	configPath := filepath.Join(projectDir, config.ConfigFileName)
+	if err := os.WriteFile(configPath, []byte("name = \"api\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	state := &State{Directory: projectDir, AutoApplied: true}
+	RecordApplied(state, cfg, projectDir)
+	if err := SaveState(state); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	status, err = LoadPromptStatus()
+	if err != nil {
+		t.Fatalf("Failed to load status: %v", err)
+	}
+	if !status.Active || status.Project != "api" || status.Directory != projectDir || !status.AutoApplied || status.Stale {
+		t.Errorf("Unexpected status after apply: %+v", status)
+	}
+
+	// A local config added after the apply makes it stale
+	local := filepath.Join(projectDir, config.LocalConfigFileName)
+	if err := os.WriteFile(local, []byte(""), 0644); err != nil {
+		t.Fatalf("Failed to write local config: %v", err)
+	}
+	later := state.AppliedAt.Add(time.Second)
+	if err := os.Chtimes(local, later, later); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	if status, _ = LoadPromptStatus(); !status.Stale {
+		t.Error("Expected a local config added after the apply to make it stale")
+	}
+	os.Remove(local)
+
+	// So does an edit of the config
+	if err := os.Chtimes(configPath, later, later); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	if status, _ = LoadPromptStatus(); !status.Stale {
+		t.Error("Expected an edited config to make it stale")
+	}
+}
+
+func TestPromptStatusFormat(t *testing.T) {
+	status := &PromptStatus{Active: true, Project: "api", Profile: "prod", Directory: "/src/api", Stale: true}
+
+	tests := []struct {
+		name   string
+		status *PromptStatus
+		format string
+		want   string
+	}{
+		{"default format", status, "", "api:prod (stale config)"},
+		{"default profile is hidden", &PromptStatus{Active: true, Project: "api", Profile: DefaultProfile}, "", "api"},
+		{"placeholders", status, "[{project}/{profile} {dir}] {warning}", "[api/prod /src/api] stale config"},
+		{"inactive", &PromptStatus{}, "[{project}]", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.Format(tt.format); got != tt.want {
+				t.Errorf("Format(%q) = %q, want %q", tt.format, got, tt.want)
+			}
+		})
+	}
+}
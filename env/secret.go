@@ -0,0 +1,333 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+// Secrets are encrypted with a random data key using AES-256-GCM. The data
+// key is wrapped once per recipient with a key derived (HKDF-SHA256) from an
+// ephemeral X25519 exchange, so any recipient's identity can decrypt.
+const (
+	secretPrefix    = "direnv-secret:v1:"
+	secretInfo      = "direnv-secret v1"
+	identityFile    = "identity"
+	recipientSuffix = ".pub"
+	keySize         = 32
+	wrappedKeySize  = keySize + 16 // data key plus GCM tag
+	stanzaSize      = keySize + wrappedKeySize
+)
+
+var errNoMatchingRecipient = errors.New("no recipient stanza matches the local identity")
+
+// ErrNoIdentity is returned where a secret must be decrypted but no local
+// identity exists yet.
+var ErrNoIdentity = errors.New("no identity; run direnv secret pubkey and ask a teammate to rekey")
+
+// KeysDir returns the directory holding the local identity and the
+// recipient public keys (*.pub) that secrets are encrypted to.
+func KeysDir() string {
+	return filepath.Join(stateDir, "keys")
+}
+
+// ReadIdentity reads the local private key. Unlike LoadIdentity it never
+// creates one: a new key can't decrypt anything until a teammate rekeys.
+func ReadIdentity() (*ecdh.PrivateKey, error) {
+	path := filepath.Join(KeysDir(), identityFile)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoIdentity
+		}
+		return nil, fmt.Errorf("failed to read identity: %w", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity file %s: %w", path, err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// LoadIdentity reads the local private key, generating one (and a matching
+// self.pub recipient) on first use.
+func LoadIdentity() (*ecdh.PrivateKey, error) {
+	key, err := ReadIdentity()
+	if !errors.Is(err, ErrNoIdentity) {
+		return key, err
+	}
+
+	key, err = ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate identity: %w", err)
+	}
+
+	if err := os.MkdirAll(KeysDir(), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create keys directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(KeysDir(), identityFile), []byte(base64.StdEncoding.EncodeToString(key.Bytes())+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write identity: %w", err)
+	}
+	selfPath := filepath.Join(KeysDir(), "self"+recipientSuffix)
+	if err := os.WriteFile(selfPath, []byte(FormatPublicKey(key.PublicKey())+"\n"), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	return key, nil
+}
+
+// FormatPublicKey encodes a recipient key the way *.pub files store it.
+func FormatPublicKey(key *ecdh.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key.Bytes())
+}
+
+// LoadRecipients returns every public key in the keys directory, sorted by
+// file name so encryption output is stable across runs.
+func LoadRecipients() ([]*ecdh.PublicKey, error) {
+	matches, err := filepath.Glob(filepath.Join(KeysDir(), "*"+recipientSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recipients: %w", err)
+	}
+	sort.Strings(matches)
+
+	recipients := make([]*ecdh.PublicKey, 0, len(matches))
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recipient %s: %w", path, err)
+		}
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %s: %w", path, err)
+		}
+		key, err := ecdh.X25519().NewPublicKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %s: %w", path, err)
+		}
+		recipients = append(recipients, key)
+	}
+
+	return recipients, nil
+}
+
+// EncryptSecret encrypts plaintext to the given recipients and returns the
+// armored form stored in config files.
+func EncryptSecret(plaintext string, recipients []*ecdh.PublicKey) (string, error) {
+	if len(recipients) == 0 {
+		return "", fmt.Errorf("no recipients found in %s", KeysDir())
+	}
+	if len(recipients) > 255 {
+		return "", fmt.Errorf("too many recipients: %d", len(recipients))
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	header := []byte{byte(len(recipients))}
+	for _, recipient := range recipients {
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate ephemeral key: %w", err)
+		}
+		salt := append(ephemeral.PublicKey().Bytes(), recipient.Bytes()...)
+		wrapKey, err := deriveWrapKey(ephemeral, recipient, salt)
+		if err != nil {
+			return "", err
+		}
+		aead, err := newGCM(wrapKey)
+		if err != nil {
+			return "", err
+		}
+		// Each wrap key is used exactly once, so a zero nonce is safe.
+		wrapped := aead.Seal(nil, make([]byte, aead.NonceSize()), dataKey, nil)
+		header = append(header, ephemeral.PublicKey().Bytes()...)
+		header = append(header, wrapped...)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	payload := append(append([]byte{}, header...), nonce...)
+	payload = aead.Seal(payload, nonce, []byte(plaintext), header)
+
+	return secretPrefix + base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// DecryptSecret decrypts an armored secret with the given identity.
+func DecryptSecret(armored string, identity *ecdh.PrivateKey) (string, error) {
+	if !strings.HasPrefix(armored, secretPrefix) {
+		return "", fmt.Errorf("not a direnv secret (missing %q prefix)", secretPrefix)
+	}
+	payload, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(armored, secretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed secret: %w", err)
+	}
+	if len(payload) < 1 {
+		return "", fmt.Errorf("malformed secret: empty payload")
+	}
+
+	count := int(payload[0])
+	headerLen := 1 + count*stanzaSize
+	if count == 0 || len(payload) < headerLen {
+		return "", fmt.Errorf("malformed secret: truncated header")
+	}
+	header := payload[:headerLen]
+
+	var dataKey []byte
+	self := identity.PublicKey().Bytes()
+	for i := 0; i < count; i++ {
+		stanza := header[1+i*stanzaSize : 1+(i+1)*stanzaSize]
+		ephemeral, err := ecdh.X25519().NewPublicKey(stanza[:keySize])
+		if err != nil {
+			continue
+		}
+		salt := append(ephemeral.Bytes(), self...)
+		wrapKey, err := deriveWrapKey(identity, ephemeral, salt)
+		if err != nil {
+			return "", err
+		}
+		aead, err := newGCM(wrapKey)
+		if err != nil {
+			return "", err
+		}
+		if key, err := aead.Open(nil, make([]byte, aead.NonceSize()), stanza[keySize:], nil); err == nil {
+			dataKey = key
+			break
+		}
+	}
+	if dataKey == nil {
+		return "", errNoMatchingRecipient
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	body := payload[headerLen:]
+	if len(body) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed secret: truncated body")
+	}
+	plaintext, err := aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], header)
+	if err != nil {
+		return "", fmt.Errorf("secret failed authentication: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// RekeySecret re-encrypts an armored secret to the current recipients.
+func RekeySecret(armored string, identity *ecdh.PrivateKey, recipients []*ecdh.PublicKey) (string, error) {
+	plaintext, err := DecryptSecret(armored, identity)
+	if err != nil {
+		return "", err
+	}
+	return EncryptSecret(plaintext, recipients)
+}
+
+// deriveWrapKey derives the per-recipient wrap key. The salt binds it to
+// both the ephemeral and the recipient public key.
+func deriveWrapKey(private *ecdh.PrivateKey, public *ecdh.PublicKey, salt []byte) ([]byte, error) {
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return nil, fmt.Errorf("key exchange failed: %w", err)
+	}
+	key, err := hkdf.Key(sha256.New, shared, salt, secretInfo, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("key derivation failed: %w", err)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// sourceValues returns the values of all table-form environment entries:
+// results already evaluated by the config loader, and encrypted values
+// decrypted now. Each failure names its variable instead of exporting an
+// empty value.
+func sourceValues(sources map[string]config.Source) (map[string]string, error) {
+	values := make(map[string]string, len(sources))
+	var identity *ecdh.PrivateKey
+
+	var errs []error
+	for key, src := range sources {
+		if src.Encrypted == "" {
+			values[key] = src.Value
+			continue
+		}
+		if identity == nil {
+			var err error
+			if identity, err = ReadIdentity(); err != nil {
+				return nil, err
+			}
+		}
+		plaintext, err := DecryptSecret(src.Encrypted, identity)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to decrypt %s: %w", key, err))
+			continue
+		}
+		values[key] = plaintext
+	}
+	if len(errs) > 0 {
+		sortErrors(errs)
+		return nil, errors.Join(errs...)
+	}
+
+	return values, nil
+}
+
+func sortErrors(errs []error) {
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+}
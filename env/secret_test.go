@@ -0,0 +1,204 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/shell"
+)
+
+func useTempStateDir(t *testing.T) {
+	t.Helper()
+	originalStateDir := stateDir
+	stateDir = t.TempDir()
+	t.Cleanup(func() { stateDir = originalStateDir })
+}
+
+func TestSecretRoundTrip(t *testing.T) {
+	useTempStateDir(t)
+
+	identity, err := LoadIdentity()
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+
+	teammate, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate teammate key: %v", err)
+	}
+
+	recipients, err := LoadRecipients()
+	if err != nil {
+		t.Fatalf("Failed to load recipients: %v", err)
+	}
+	if len(recipients) != 1 {
+		t.Fatalf("Expected self.pub to be created with the identity, got %d recipients", len(recipients))
+	}
+	recipients = append(recipients, teammate.PublicKey())
+
+	armored, err := EncryptSecret("s3cr3t", recipients)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if !strings.HasPrefix(armored, secretPrefix) {
+		t.Errorf("Expected armored secret to start with %q, got %q", secretPrefix, armored)
+	}
+
+	for name, key := range map[string]*ecdh.PrivateKey{"self": identity, "teammate": teammate} {
+		plaintext, err := DecryptSecret(armored, key)
+		if err != nil {
+			t.Fatalf("%s failed to decrypt: %v", name, err)
+		}
+		if plaintext != "s3cr3t" {
+			t.Errorf("%s decrypted %q, want %q", name, plaintext, "s3cr3t")
+		}
+	}
+
+	outsider, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	if _, err := DecryptSecret(armored, outsider); err == nil {
+		t.Error("Expected decryption with a non-recipient key to fail")
+	}
+}
+
+func TestDecryptSecretTampered(t *testing.T) {
+	useTempStateDir(t)
+
+	identity, err := LoadIdentity()
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+
+	armored, err := EncryptSecret("value", []*ecdh.PublicKey{identity.PublicKey()})
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	// Flip a character in the ciphertext body
+	tampered := []byte(armored)
+	i := len(tampered) - 5
+	if tampered[i] == 'A' {
+		tampered[i] = 'B'
+	} else {
+		tampered[i] = 'A'
+	}
+
+	if _, err := DecryptSecret(string(tampered), identity); err == nil {
+		t.Error("Expected tampered secret to fail authentication")
+	}
+}
+
+func TestRekeySecret(t *testing.T) {
+	useTempStateDir(t)
+
+	identity, err := LoadIdentity()
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	newMember, _ := ecdh.X25519().GenerateKey(rand.Reader)
+
+	armored, err := EncryptSecret("value", []*ecdh.PublicKey{identity.PublicKey()})
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	rekeyed, err := RekeySecret(armored, identity, []*ecdh.PublicKey{identity.PublicKey(), newMember.PublicKey()})
+	if err != nil {
+		t.Fatalf("Failed to rekey: %v", err)
+	}
+
+	plaintext, err := DecryptSecret(rekeyed, newMember)
+	if err != nil {
+		t.Fatalf("New recipient failed to decrypt rekeyed secret: %v", err)
+	}
+	if plaintext != "value" {
+		t.Errorf("Expected %q, got %q", "value", plaintext)
+	}
+}
+
+func TestExportForShellSecrets(t *testing.T) {
+	useTempStateDir(t)
+
+	identity, err := LoadIdentity()
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	armored, err := EncryptSecret("p@ss", []*ecdh.PublicKey{identity.PublicKey()})
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	cfg := &config.Config{
+		Environment: map[string]string{},
+		Sources: map[string]config.Source{
+			"DB_PASSWORD": {Encrypted: armored},
+		},
+	}
+
+	result, err := ExportForShell(cfg, "/project", shell.DialectFor(shell.Bash))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
+	if !strings.Contains(result, "export DB_PASSWORD='p@ss'") {
+		t.Errorf("Expected decrypted DB_PASSWORD in output, got: %s", result)
+	}
+
+	cfg.Sources["API_TOKEN"] = config.Source{Encrypted: "direnv-secret:v1:garbage"}
+	result, err = ExportForShell(cfg, "/project", shell.DialectFor(shell.Bash))
+	if err == nil {
+		t.Fatal("Expected error for undecryptable secret")
+	}
+	if !strings.Contains(err.Error(), "API_TOKEN") {
+		t.Errorf("Expected error to name API_TOKEN, got: %v", err)
+	}
+	if result != "" {
+		t.Errorf("Expected no output on failure, got: %s", result)
+	}
+}
+
+func TestExportForShellWithoutIdentity(t *testing.T) {
+	useTempStateDir(t)
+
+	cfg := &config.Config{
+		Environment: map[string]string{},
+		Sources: map[string]config.Source{
+			"DB_PASSWORD": {Encrypted: "direnv-secret:v1:garbage"},
+		},
+	}
+
+	// Applying must not create a key that nothing is encrypted to
+	_, err := ExportForShell(cfg, "/project", shell.DialectFor(shell.Bash))
+	if !errors.Is(err, ErrNoIdentity) {
+		t.Fatalf("Expected ErrNoIdentity, got: %v", err)
+	}
+	if _, err := os.Stat(KeysDir()); !os.IsNotExist(err) {
+		t.Errorf("Expected no keys directory, got: %v", err)
+	}
+
+	if _, err := LoadIdentity(); err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	if _, err := ReadIdentity(); err != nil {
+		t.Errorf("Expected the created identity to be read, got: %v", err)
+	}
+}
@@ -0,0 +1,523 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+// SuperviseCommand is the hidden direnv subcommand that runs a service's
+// supervisor. It is not meant to be called by hand.
+const SuperviseCommand = "__supervise"
+
+const maxRestartBackoff = 30 * time.Second
+
+// stopTimeout is how long a service gets to exit on SIGTERM before its
+// process group is killed. Tests shorten it.
+var stopTimeout = 5 * time.Second
+
+// ServiceRecord is written when a service is started. PID is that of its
+// supervisor, which leads the process group of the service.
+type ServiceRecord struct {
+	Name         string    `json:"name"`
+	Project      string    `json:"project"`
+	Run          string    `json:"run"`
+	Dir          string    `json:"dir"`
+	Restart      string    `json:"restart"`
+	Shell        string    `json:"shell"`
+	PID          int       `json:"pid"`
+	ProcessStart string    `json:"process_start,omitempty"` // start time of PID, to detect its reuse
+	Started      time.Time `json:"started"`
+}
+
+// serviceStatus is written by the supervisor whenever the service exits.
+type serviceStatus struct {
+	Restarts int  `json:"restarts"`
+	ExitCode int  `json:"exit_code"`
+	Exited   bool `json:"exited"` // the supervisor gave up or wasn't asked to restart
+}
+
+// ServiceState describes a configured service as observed now.
+type ServiceState struct {
+	Name     string
+	Service  config.Service
+	Record   *ServiceRecord // nil if never started
+	Running  bool
+	Ready    bool // ready.tcp accepts connections; false without a check
+	Restarts int
+	ExitCode int // -1 unless the service exited
+}
+
+// Status describes the service state in a few words.
+func (s ServiceState) Status() string {
+	switch {
+	case s.Running:
+		return "running"
+	case s.ExitCode >= 0:
+		return fmt.Sprintf("exited %d", s.ExitCode)
+	default:
+		return "stopped"
+	}
+}
+
+// ServicesDir holds the records, status and logs of a project's services.
+func ServicesDir(project string) string {
+	return filepath.Join(stateDir, "services", projectKey(project))
+}
+
+func serviceFile(project, name, ext string) string {
+	return filepath.Join(ServicesDir(project), name+ext)
+}
+
+// ServiceLogFile returns the log of a project's service.
+func ServiceLogFile(project, name string) string {
+	return serviceFile(project, name, ".log")
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// ServiceStates reports the state of every service in cfg, sorted by name.
+func ServiceStates(cfg *config.Config, project string) []ServiceState {
+	names := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	states := make([]ServiceState, 0, len(names))
+	for _, name := range names {
+		states = append(states, serviceState(cfg.Services[name], project, name))
+	}
+	return states
+}
+
+func serviceState(svc config.Service, project, name string) ServiceState {
+	state := ServiceState{Name: name, Service: svc, ExitCode: -1}
+
+	var record ServiceRecord
+	if err := readJSON(serviceFile(project, name, ".json"), &record); err != nil {
+		return state
+	}
+	state.Record = &record
+	state.Running = isProcess(record.PID, record.ProcessStart)
+
+	var status serviceStatus
+	if err := readJSON(serviceFile(project, name, ".status"), &status); err == nil {
+		state.Restarts = status.Restarts
+		if status.Exited && !state.Running {
+			state.ExitCode = status.ExitCode
+		}
+	}
+	if state.Running && svc.Ready.TCP != "" {
+		state.Ready = tcpReady(svc.Ready.TCP)
+	}
+	return state
+}
+
+func tcpReady(address string) bool {
+	conn, err := net.DialTimeout("tcp", address, 500*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// StartService starts the named service of cfg under a supervisor, unless
+// it is already running. The service sees the project environment plus its
+// own env entries. It does not wait for the service to become ready.
+func StartService(cfg *config.Config, project, name string) (bool, error) {
+	svc, ok := cfg.Services[name]
+	if !ok {
+		return false, fmt.Errorf("service '%s' not found in config", name)
+	}
+	if serviceState(svc, project, name).Running {
+		return false, nil
+	}
+
+	ctx := NewContext(cfg, project)
+	values, err := buildEnvironment(cfg, ctx)
+	if err != nil {
+		return false, err
+	}
+	environ := os.Environ()
+	for key, value := range values {
+		environ = append(environ, key+"="+value)
+	}
+	for key, value := range svc.Env {
+		expanded, err := expandEnvVar(value, ctx)
+		if err != nil {
+			return false, fmt.Errorf("service %s: failed to expand %s: %w", name, key, err)
+		}
+		environ = append(environ, key+"="+expanded)
+	}
+	environ = append(environ, "PROJECT_ROOT="+project)
+
+	dir := project
+	if svc.Dir != "" {
+		dir = svc.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(project, dir)
+		}
+	}
+
+	shell := scriptShell()
+
+	if err := os.MkdirAll(ServicesDir(project), 0700); err != nil {
+		return false, fmt.Errorf("failed to create services directory: %w", err)
+	}
+	record := ServiceRecord{
+		Name:    name,
+		Project: project,
+		Run:     svc.Run,
+		Dir:     dir,
+		Restart: svc.RestartPolicy(),
+		Shell:   shell,
+		Started: time.Now(),
+	}
+	os.Remove(serviceFile(project, name, ".status"))
+
+	log, err := os.OpenFile(ServiceLogFile(project, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return false, fmt.Errorf("failed to open service log: %w", err)
+	}
+	defer log.Close()
+	fmt.Fprintf(log, "direnv: starting %s at %s\n", name, record.Started.Format(time.RFC3339))
+
+	self, err := os.Executable()
+	if err != nil {
+		return false, fmt.Errorf("failed to locate direnv: %w", err)
+	}
+
+	// The spec is written before the supervisor starts, which reads it
+	if err := writeJSON(serviceFile(project, name, ".json"), record); err != nil {
+		return false, fmt.Errorf("failed to write service record: %w", err)
+	}
+
+	cmd := exec.Command(self, SuperviseCommand, serviceFile(project, name, ".json"))
+	cmd.Dir = dir
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.Env = environ
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return false, fmt.Errorf("failed to start service %s: %w", name, err)
+	}
+	// Reap the supervisor should it finish while direnv is still running
+	go cmd.Wait()
+
+	record.PID = cmd.Process.Pid
+	record.ProcessStart = processStart(record.PID)
+	if err := writeJSON(serviceFile(project, name, ".json"), record); err != nil {
+		return false, fmt.Errorf("failed to write service record: %w", err)
+	}
+	return true, nil
+}
+
+// WaitReady waits until the service accepts connections on ready.tcp. It
+// fails early if the service stops running.
+func WaitReady(cfg *config.Config, project, name string) error {
+	svc := cfg.Services[name]
+	if svc.Ready.TCP == "" {
+		return nil
+	}
+
+	deadline := time.Now().Add(svc.ReadyTimeout())
+	for {
+		state := serviceState(svc, project, name)
+		if state.Ready {
+			return nil
+		}
+		if !state.Running {
+			return fmt.Errorf("service %s stopped before it was ready; see %s", name, ServiceLogFile(project, name))
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service %s not ready on %s after %s", name, svc.Ready.TCP, svc.ReadyTimeout())
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// StopService stops the service's supervisor and everything it started.
+// Processes still left in its group after stopTimeout are killed, and the
+// record of the service is removed.
+func StopService(project, name string) (bool, error) {
+	var record ServiceRecord
+	if err := readJSON(serviceFile(project, name, ".json"), &record); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read service record: %w", err)
+	}
+	if !isProcess(record.PID, record.ProcessStart) {
+		return false, nil
+	}
+
+	if err := killJob(record.PID); err != nil {
+		return false, fmt.Errorf("failed to stop service %s: %w", name, err)
+	}
+	killed := false
+	deadline := time.Now().Add(stopTimeout)
+	for jobGroupRunning(record.PID) {
+		if time.Now().After(deadline) {
+			if killed {
+				return true, fmt.Errorf("service %s did not stop after SIGKILL", name)
+			}
+			if err := forceKillJob(record.PID); err != nil && jobGroupRunning(record.PID) {
+				return true, fmt.Errorf("failed to kill service %s: %w", name, err)
+			}
+			killed = true
+			deadline = time.Now().Add(stopTimeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// The supervisor was killed before it could record how the service ended
+	if killed {
+		if err := os.Remove(serviceFile(project, name, ".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return true, fmt.Errorf("failed to remove service record: %w", err)
+		}
+	}
+
+	if log, err := os.OpenFile(ServiceLogFile(project, name), os.O_WRONLY|os.O_APPEND, 0600); err == nil {
+		if killed {
+			fmt.Fprintf(log, "direnv: killed %s at %s, still running %s after SIGTERM\n", name, time.Now().Format(time.RFC3339), stopTimeout)
+		} else {
+			fmt.Fprintf(log, "direnv: stopped %s at %s\n", name, time.Now().Format(time.RFC3339))
+		}
+		log.Close()
+	}
+	return true, nil
+}
+
+// StopProjectServices stops every running service of the project, including
+// services no longer in its config.
+func StopProjectServices(project string) error {
+	matches, err := filepath.Glob(serviceFile(project, "*", ".json"))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, match := range matches {
+		name := strings.TrimSuffix(filepath.Base(match), ".json")
+		if _, err := StopService(project, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Supervise runs the service described by the record at recordPath until
+// it exits, restarting it as its policy says. It is the body of the hidden
+// supervisor command; its output goes to the service log.
+func Supervise(recordPath string) error {
+	var record ServiceRecord
+	if err := readJSON(recordPath, &record); err != nil {
+		return fmt.Errorf("failed to read service record: %w", err)
+	}
+	statusPath := strings.TrimSuffix(recordPath, ".json") + ".status"
+
+	status := serviceStatus{}
+	backoff := time.Second
+	for {
+		started := time.Now()
+		cmd := exec.Command(record.Shell, "-c", record.Run)
+		cmd.Dir = record.Dir
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		status.ExitCode = 0
+		if err := cmd.Run(); err != nil {
+			status.ExitCode = 1
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				status.ExitCode = exitErr.ExitCode()
+			} else {
+				fmt.Printf("direnv: %s: %v\n", record.Name, err)
+			}
+		}
+
+		restart := record.Restart == config.RestartAlways ||
+			(record.Restart == config.RestartOnFailure && status.ExitCode != 0)
+		if !restart {
+			status.Exited = true
+			writeJSON(statusPath, status)
+			fmt.Printf("direnv: %s exited with %d\n", record.Name, status.ExitCode)
+			return nil
+		}
+
+		// A service that ran for a while gets a fresh backoff
+		if time.Since(started) > maxRestartBackoff {
+			backoff = time.Second
+		}
+		status.Restarts++
+		writeJSON(statusPath, status)
+		fmt.Printf("direnv: %s exited with %d, restarting in %s\n", record.Name, status.ExitCode, backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxRestartBackoff)
+	}
+}
+
+// projectSessions lists the shells that have the project loaded.
+type projectSessions struct {
+	Sessions []string `json:"sessions"`
+}
+
+// sessionsFile has no .json extension so it can't clash with a service
+func sessionsFile(project string) string {
+	return filepath.Join(ServicesDir(project), ".sessions")
+}
+
+func liveSessions(project string) []string {
+	var sessions projectSessions
+	readJSON(sessionsFile(project), &sessions)
+
+	live := sessions.Sessions[:0]
+	for _, id := range sessions.Sessions {
+		if sessionAlive(id) {
+			live = append(live, id)
+		}
+	}
+	return live
+}
+
+// EnterProject records that this shell loaded the project and starts the
+// services marked autostart. It returns the names of the services started.
+func EnterProject(cfg *config.Config, project string) ([]string, error) {
+	if len(cfg.Services) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(ServicesDir(project), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create services directory: %w", err)
+	}
+
+	session := currentSession()
+	sessions := liveSessions(project)
+	found := false
+	for _, id := range sessions {
+		found = found || id == session
+	}
+	if !found {
+		sessions = append(sessions, session)
+	}
+	if err := writeJSON(sessionsFile(project), projectSessions{Sessions: sessions}); err != nil {
+		return nil, fmt.Errorf("failed to record session: %w", err)
+	}
+
+	var started []string
+	var errs []error
+	for _, state := range ServiceStates(cfg, project) {
+		if !state.Service.Autostart {
+			continue
+		}
+		ok, err := StartService(cfg, project, state.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			started = append(started, state.Name)
+		}
+	}
+	return started, errors.Join(errs...)
+}
+
+// LeaveProject records that this shell left the project. When no other
+// live shell has it loaded, its services are stopped.
+func LeaveProject(project string) error {
+	if _, err := os.Stat(ServicesDir(project)); err != nil {
+		return nil // the project never had services
+	}
+
+	session := currentSession()
+	var remaining []string
+	for _, id := range liveSessions(project) {
+		if id != session {
+			remaining = append(remaining, id)
+		}
+	}
+	if err := writeJSON(sessionsFile(project), projectSessions{Sessions: remaining}); err != nil {
+		return fmt.Errorf("failed to record session: %w", err)
+	}
+
+	if len(remaining) > 0 {
+		return nil
+	}
+	return StopProjectServices(project)
+}
+
+// cleanupServices stops the services of projects whose shells have all
+// exited without leaving, and returns how many projects it stopped.
+func cleanupServices() int {
+	dirs, err := filepath.Glob(filepath.Join(stateDir, "services", "*"))
+	if err != nil {
+		return 0
+	}
+
+	cleaned := 0
+	for _, dir := range dirs {
+		var sessions projectSessions
+		if err := readJSON(filepath.Join(dir, ".sessions"), &sessions); err != nil || len(sessions.Sessions) == 0 {
+			continue
+		}
+		alive := false
+		for _, id := range sessions.Sessions {
+			alive = alive || sessionAlive(id)
+		}
+		if alive {
+			continue
+		}
+
+		records, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		for _, path := range records {
+			var record ServiceRecord
+			if readJSON(path, &record) != nil {
+				continue
+			}
+			StopService(record.Project, record.Name)
+		}
+		writeJSON(filepath.Join(dir, ".sessions"), projectSessions{})
+		cleaned++
+	}
+	return cleaned
+}
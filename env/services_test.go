@@ -0,0 +1,214 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+// StartService runs the supervisor by re-executing the current binary, which
+// under `go test` is the test binary.
+func TestMain(m *testing.M) {
+	if len(os.Args) == 3 && os.Args[1] == SuperviseCommand {
+		if err := Supervise(os.Args[2]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func serviceTestConfig(services map[string]config.Service) *config.Config {
+	return &config.Config{
+		Environment: make(map[string]string),
+		Scripts:     make(map[string]string),
+		Services:    services,
+	}
+}
+
+func waitForService(t *testing.T, cfg *config.Config, project, name string, done func(ServiceState) bool) ServiceState {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		state := serviceState(cfg.Services[name], project, name)
+		if done(state) {
+			return state
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Service %s did not reach the expected state, last %+v", name, state)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSupervise(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("services need a POSIX shell")
+	}
+	dir := t.TempDir()
+
+	recordPath := filepath.Join(dir, "once.json")
+	record := ServiceRecord{Name: "once", Run: "echo hello; exit 4", Dir: dir, Restart: config.RestartNo, Shell: "/bin/sh"}
+	if err := writeJSON(recordPath, record); err != nil {
+		t.Fatalf("Failed to write record: %v", err)
+	}
+	if err := Supervise(recordPath); err != nil {
+		t.Fatalf("Supervise failed: %v", err)
+	}
+
+	var status serviceStatus
+	if err := readJSON(filepath.Join(dir, "once.status"), &status); err != nil {
+		t.Fatalf("Failed to read status: %v", err)
+	}
+	if !status.Exited || status.ExitCode != 4 || status.Restarts != 0 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestStartStopService(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("services need a POSIX shell")
+	}
+	useTempStateDir(t)
+	t.Setenv("SHELL", "/bin/sh")
+	project := t.TempDir()
+
+	cfg := serviceTestConfig(map[string]config.Service{
+		"web":   {Run: "echo serving $GREETING; sleep 30", Env: map[string]string{"GREETING": "hi"}},
+		"flaky": {Run: "exit 3", Restart: config.RestartOnFailure},
+	})
+
+	started, err := StartService(cfg, project, "web")
+	if err != nil || !started {
+		t.Fatalf("Failed to start web: %v", err)
+	}
+	waitForService(t, cfg, project, "web", func(s ServiceState) bool { return s.Running })
+
+	// Starting a running service is a no-op
+	if started, err := StartService(cfg, project, "web"); err != nil || started {
+		t.Errorf("Expected web to be left running, got started=%v err=%v", started, err)
+	}
+
+	if _, err := StartService(cfg, project, "flaky"); err != nil {
+		t.Fatalf("Failed to start flaky: %v", err)
+	}
+	waitForService(t, cfg, project, "flaky", func(s ServiceState) bool { return s.Restarts >= 1 })
+
+	if err := StopProjectServices(project); err != nil {
+		t.Fatalf("Failed to stop services: %v", err)
+	}
+	for _, state := range ServiceStates(cfg, project) {
+		if state.Running {
+			t.Errorf("Expected %s to be stopped", state.Name)
+		}
+	}
+
+	log, err := os.ReadFile(ServiceLogFile(project, "web"))
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if !strings.Contains(string(log), "serving hi") || !strings.Contains(string(log), "direnv: stopped web") {
+		t.Errorf("Unexpected log:\n%s", log)
+	}
+}
+
+func TestStopServiceKillsAfterTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("services need a POSIX shell")
+	}
+	useTempStateDir(t)
+	t.Setenv("SHELL", "/bin/sh")
+	project := t.TempDir()
+
+	defer func(timeout time.Duration) { stopTimeout = timeout }(stopTimeout)
+	stopTimeout = 300 * time.Millisecond
+
+	cfg := serviceTestConfig(map[string]config.Service{
+		"stubborn": {Run: "trap '' TERM; echo ready; sleep 30"},
+	})
+	if _, err := StartService(cfg, project, "stubborn"); err != nil {
+		t.Fatalf("Failed to start stubborn: %v", err)
+	}
+	state := waitForService(t, cfg, project, "stubborn", func(s ServiceState) bool { return s.Running })
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		log, _ := os.ReadFile(ServiceLogFile(project, "stubborn"))
+		if strings.Contains(string(log), "ready") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Service did not start its command")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if stopped, err := StopService(project, "stubborn"); err != nil || !stopped {
+		t.Fatalf("Expected stubborn to be killed, got stopped=%v err=%v", stopped, err)
+	}
+	if jobGroupRunning(state.Record.PID) {
+		t.Error("Expected the whole process group to be killed")
+	}
+	if _, err := os.Stat(serviceFile(project, "stubborn", ".json")); !os.IsNotExist(err) {
+		t.Errorf("Expected the service record to be removed, got %v", err)
+	}
+	log, _ := os.ReadFile(ServiceLogFile(project, "stubborn"))
+	if !strings.Contains(string(log), "direnv: killed stubborn") {
+		t.Errorf("Unexpected log:\n%s", log)
+	}
+}
+
+func TestEnterLeaveProject(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("services need a POSIX shell")
+	}
+	useTempStateDir(t)
+	t.Setenv("SHELL", "/bin/sh")
+	// Sessions must be live processes to count
+	t.Setenv("DIRENV_SHELL_PID", strconv.Itoa(os.Getpid()))
+	project := t.TempDir()
+
+	cfg := serviceTestConfig(map[string]config.Service{
+		"db":   {Run: "sleep 30", Autostart: true},
+		"mock": {Run: "sleep 30"},
+	})
+
+	started, err := EnterProject(cfg, project)
+	if err != nil {
+		t.Fatalf("EnterProject failed: %v", err)
+	}
+	if len(started) != 1 || started[0] != "db" {
+		t.Errorf("Expected only db to autostart, got %v", started)
+	}
+	waitForService(t, cfg, project, "db", func(s ServiceState) bool { return s.Running })
+
+	if err := LeaveProject(project); err != nil {
+		t.Fatalf("LeaveProject failed: %v", err)
+	}
+	if serviceState(cfg.Services["db"], project, "db").Running {
+		t.Error("Expected db to stop when the last session left")
+	}
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/TierOne-Software/direnv/shell"
+)
+
+// SessionVar carries the session ID from a shell to its children. The
+// shell integration exports it with the first code it evaluates.
+const SessionVar = "DIRENV_SESSION"
+
+// session records what happened in a shell session beyond the lifetime of
+// a single applied environment.
+type session struct {
+	Entered []string `json:"entered"`
+	// Restored is the project restored by hand while the shell was in it,
+	// which the prompt hook doesn't apply again until the shell leaves it
+	Restored string `json:"restored,omitempty"`
+	// Parent is the session this one was started from, whose environment
+	// it inherited
+	Parent string `json:"parent,omitempty"`
+}
+
+// currentSession returns the ID of this shell's session. It starts with
+// the shell's PID, so a session whose ID is inherited but doesn't start
+// with the PID belongs to a parent shell, or to the shell a tmux server was
+// started from. The child's ID is derived from the parent's, so it is the
+// same for every direnv command the child runs, before it is exported.
+// exec keeps the PID, and with it the session.
+func currentSession() string {
+	id, _ := resolveSession()
+	return id
+}
+
+// resolveSession returns the ID of this shell's session and, if the
+// session started in this process, the ID of the session it inherited.
+func resolveSession() (string, string) {
+	pid := strconv.Itoa(getShellPID())
+	inherited := os.Getenv(SessionVar)
+	if inherited == "" || inherited == pid || strings.HasPrefix(inherited, pid+"-") {
+		if inherited == "" {
+			return pid, ""
+		}
+		return inherited, ""
+	}
+	sum := sha256.Sum256([]byte(inherited))
+	return pid + "-" + hex.EncodeToString(sum[:4]), inherited
+}
+
+// sessionAlive reports whether the shell that owns session id is still
+// running. The ID starts with the shell's PID.
+func sessionAlive(id string) bool {
+	pidStr, _, _ := strings.Cut(id, "-")
+	pid, err := strconv.Atoi(pidStr)
+	return err == nil && isProcessRunning(pid)
+}
+
+func sessionFile() string {
+	return filepath.Join(stateDir, fmt.Sprintf("session_%s.json", currentSession()))
+}
+
+func loadSession() (*session, error) {
+	var sess session
+	data, err := os.ReadFile(sessionFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &sess, nil
+		}
+		return nil, fmt.Errorf("failed to read session file: %w", err)
+	}
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+	return &sess, nil
+}
+
+func saveSession(sess *session) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if err := os.WriteFile(sessionFile(), data, 0600); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	return nil
+}
+
+// InheritSession starts a child session on its first direnv command that
+// changes the environment. The child's environment is the one its parent
+// applied, so it takes over the parent's state and can restore it.
+// Background jobs stay with the parent.
+func InheritSession() error {
+	_, parent := resolveSession()
+	if parent == "" {
+		return nil
+	}
+	if _, err := os.Stat(sessionFile()); err == nil {
+		return nil // started before
+	}
+
+	if data, err := os.ReadFile(stateFileFor(parent)); err == nil {
+		// Only if the environment is still the one the parent applied; a
+		// tmux server, for one, may outlive many applies of its parent
+		var state State
+		if err := json.Unmarshal(data, &state); err == nil && state.Directory != "" && state.Directory == os.Getenv(VarDir) {
+			state.Jobs = nil
+			if err := SaveState(&state); err != nil {
+				return err
+			}
+		}
+	}
+	return saveSession(&session{Parent: parent})
+}
+
+// SessionInfo returns the ID of this shell's session and of the session it
+// was started from, or "" if it wasn't.
+func SessionInfo() (string, string) {
+	id, parent := resolveSession()
+	if parent != "" {
+		return id, parent // not exported yet, maybe not started
+	}
+	sess, err := loadSession()
+	if err != nil {
+		return id, ""
+	}
+	return id, sess.Parent
+}
+
+// ExportSession returns code exporting the session ID, or "" if the shell
+// has it already.
+func ExportSession(d shell.Dialect) string {
+	id := currentSession()
+	if os.Getenv(SessionVar) == id {
+		return ""
+	}
+	return d.SetVar(SessionVar, id)
+}
+
+// EnteredInSession reports whether directory was applied before in this
+// shell session. Unlike the state file, this survives a restore.
+func EnteredInSession(directory string) (bool, error) {
+	sess, err := loadSession()
+	if err != nil {
+		return false, err
+	}
+	for _, dir := range sess.Entered {
+		if dir == directory {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RecordEntered marks directory as entered in this shell session.
+func RecordEntered(directory string) error {
+	sess, err := loadSession()
+	if err != nil {
+		return err
+	}
+	for _, dir := range sess.Entered {
+		if dir == directory {
+			return nil
+		}
+	}
+	sess.Entered = append(sess.Entered, directory)
+	return saveSession(sess)
+}
+
+// RestoredInSession returns the project restored by hand in this shell
+// session, or "" if there is none.
+func RestoredInSession() (string, error) {
+	sess, err := loadSession()
+	if err != nil {
+		return "", err
+	}
+	return sess.Restored, nil
+}
+
+// RecordRestored marks directory as restored by hand in this shell session,
+// or clears the mark if directory is "".
+func RecordRestored(directory string) error {
+	sess, err := loadSession()
+	if err != nil {
+		return err
+	}
+	if sess.Restored == directory {
+		return nil
+	}
+	sess.Restored = directory
+	return saveSession(sess)
+}
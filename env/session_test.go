@@ -0,0 +1,151 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/TierOne-Software/direnv/shell"
+)
+
+func TestResolveSession(t *testing.T) {
+	t.Setenv("DIRENV_SHELL_PID", "100")
+
+	tests := []struct {
+		inherited  string
+		wantID     string
+		wantParent string
+	}{
+		{"", "100", ""},
+		{"100", "100", ""},
+		// exec keeps the PID and the session
+		{"100-1a2b3c4d", "100-1a2b3c4d", ""},
+		// A child of session 42 gets a session of its own
+		{"42", "100-", "42"},
+		{"1000", "100-", "1000"},
+	}
+	for _, tt := range tests {
+		t.Setenv(SessionVar, tt.inherited)
+		id, parent := resolveSession()
+		if !strings.HasPrefix(id, tt.wantID) || (tt.wantParent == "" && id != tt.wantID) || parent != tt.wantParent {
+			t.Errorf("resolveSession() with %q = %q, %q, want %q, %q", tt.inherited, id, parent, tt.wantID, tt.wantParent)
+		}
+		if again, _ := resolveSession(); again != id {
+			t.Errorf("Expected the same session ID again, got %q and %q", id, again)
+		}
+	}
+}
+
+// useTempSession runs a shell with PID pid, started from session parent,
+// with its state in a temporary directory.
+func useTempSession(t *testing.T, pid, parent string) {
+	t.Helper()
+	useTempStateDir(t)
+	t.Setenv("DIRENV_SHELL_PID", pid)
+	t.Setenv(SessionVar, parent)
+	originalStateFile := stateFile
+	stateFile = stateFileFor(currentSession())
+	t.Cleanup(func() { stateFile = originalStateFile })
+}
+
+func TestInheritSession(t *testing.T) {
+	useTempSession(t, "200", "42")
+	t.Setenv(VarDir, "/project")
+
+	parentState := State{
+		Directory: "/project",
+		Applied:   []string{"FOO"},
+		Jobs:      []Job{{ID: "build-1", Session: "42"}},
+	}
+	data, _ := json.Marshal(parentState)
+	if err := os.WriteFile(stateFileFor("42"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InheritSession(); err != nil {
+		t.Fatalf("InheritSession failed: %v", err)
+	}
+	state, err := LoadSavedState()
+	if err != nil || state == nil {
+		t.Fatalf("Expected inherited state, got %v, %v", state, err)
+	}
+	if state.Directory != "/project" || len(state.Applied) != 1 || len(state.Jobs) != 0 {
+		t.Errorf("Unexpected inherited state: %+v", state)
+	}
+	if id, parent := SessionInfo(); parent != "42" || !strings.HasPrefix(id, "200-") {
+		t.Errorf("SessionInfo() = %q, %q", id, parent)
+	}
+
+	// The child's own changes aren't overwritten by the parent's later
+	if err := RestoreState(); err != nil {
+		t.Fatal(err)
+	}
+	if err := InheritSession(); err != nil {
+		t.Fatal(err)
+	}
+	if HasSavedState() {
+		t.Error("Expected the child's restore to stick")
+	}
+}
+
+func TestInheritSessionChangedEnvironment(t *testing.T) {
+	useTempSession(t, "201", "43")
+	t.Setenv(VarDir, "/other")
+
+	data, _ := json.Marshal(State{Directory: "/project"})
+	if err := os.WriteFile(stateFileFor("43"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := InheritSession(); err != nil {
+		t.Fatalf("InheritSession failed: %v", err)
+	}
+	if HasSavedState() {
+		t.Error("Expected no state from a parent whose environment changed since")
+	}
+}
+
+func TestExportSession(t *testing.T) {
+	t.Setenv("DIRENV_SHELL_PID", "300")
+	bash := shell.DialectFor(shell.Bash)
+
+	t.Setenv(SessionVar, "")
+	if code := ExportSession(bash); code != "export DIRENV_SESSION='300'" {
+		t.Errorf("Unexpected session export: %q", code)
+	}
+	t.Setenv(SessionVar, "300")
+	if code := ExportSession(bash); code != "" {
+		t.Errorf("Expected no export for a known session, got %q", code)
+	}
+}
+
+func TestSessionAlive(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	for _, id := range []string{pid, pid + "-1a2b3c4d"} {
+		if !sessionAlive(id) {
+			t.Errorf("Expected session %q to be alive", id)
+		}
+	}
+	for _, id := range []string{"", "shell", "999999999-1a2b3c4d"} {
+		if sessionAlive(id) {
+			t.Errorf("Expected session %q not to be alive", id)
+		}
+	}
+}
@@ -18,40 +18,90 @@ package env
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
 )
 
 type State struct {
 	Environment map[string]string `json:"environment"`
 	Aliases     map[string]string `json:"aliases"`
 	Directory   string            `json:"directory"`
-	OnLeaveHook string            `json:"on_leave_hook"`
+	OnLeave     config.Hook       `json:"on_leave"`
+	// Applied and Functions record what the apply exported, for unloading
+	Applied   []string `json:"applied,omitempty"`
+	Functions []string `json:"functions,omitempty"`
+	// HookEnvironment holds the variables hooks added, by name
+	HookEnvironment map[string]HookValue `json:"hook_environment,omitempty"`
+	// ConfigHash identifies the effective config that was applied
+	ConfigHash string `json:"config_hash,omitempty"`
+	// Jobs are the async hooks started by the apply, cancelled on unload
+	Jobs []Job `json:"jobs,omitempty"`
+	// Project, Profile and Layers describe the applied project for
+	// direnv prompt, which doesn't read the config
+	Project string   `json:"project,omitempty"`
+	Profile string   `json:"profile,omitempty"`
+	Layers  []string `json:"layers,omitempty"`
+	// AppliedAt is when the config was read, to notice later edits
+	AppliedAt time.Time `json:"applied_at"`
+	// AutoApplied is set if the prompt hook applied the environment, which
+	// it then also unloads on leaving the project
+	AutoApplied bool `json:"auto_applied,omitempty"`
+}
+
+// UnmarshalJSON also accepts the on_leave_hook string that older versions
+// saved instead of on_leave.
+func (s *State) UnmarshalJSON(data []byte) error {
+	type plain State
+	var saved struct {
+		plain
+		OnLeaveHook string `json:"on_leave_hook"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	*s = State(saved.plain)
+	if !s.OnLeave.IsSet() && saved.OnLeaveHook != "" {
+		s.OnLeave = config.Hook{Run: saved.OnLeaveHook}
+	}
+	return nil
 }
 
 var stateFile string
 var stateDir string
 
 func init() {
-	homeDir, err := os.UserHomeDir()
+	// State files live in ~/.config/direnv/, next to the settings and the
+	// source cache
+	dir, err := config.Dir()
 	if err != nil {
-		panic(fmt.Sprintf("failed to get home directory: %v", err))
+		panic(err.Error())
 	}
-
-	// Use ~/.config/direnv/ directory for state files
-	stateDir = filepath.Join(homeDir, ".config", "direnv")
+	stateDir = dir
 
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(stateDir, 0755); err != nil {
 		panic(fmt.Sprintf("failed to create direnv config directory: %v", err))
 	}
 
-	// Use parent shell PID for consistent state across direnv command invocations
-	shellPID := getShellPID()
-	stateFile = filepath.Join(stateDir, fmt.Sprintf("state_%d.json", shellPID))
+	// State belongs to the shell session, which outlives exec and is
+	// inherited by child shells
+	stateFile = stateFileFor(currentSession())
+}
+
+// StateFile returns the path of this session's state file.
+func StateFile() string {
+	return stateFile
+}
+
+func stateFileFor(id string) string {
+	return filepath.Join(stateDir, fmt.Sprintf("state_%s.json", id))
 }
 
 // getShellPID returns the PID of the parent shell
@@ -96,9 +146,9 @@ func SaveState(state *State) error {
 	return nil
 }
 
-func SaveStateWithHook(state *State, directory string, onLeaveHook string) error {
+func SaveStateWithHook(state *State, directory string, onLeave config.Hook) error {
 	state.Directory = directory
-	state.OnLeaveHook = onLeaveHook
+	state.OnLeave = onLeave
 	return SaveState(state)
 }
 
@@ -154,6 +204,21 @@ func RestoreState() error {
 	return nil
 }
 
+// RevertApplied restores the variables recorded in state.Applied to their
+// previous values in this process.
+func RevertApplied(state *State) error {
+	for _, key := range state.Applied {
+		if oldValue, existed := state.Environment[key]; existed {
+			if err := os.Setenv(key, oldValue); err != nil {
+				return fmt.Errorf("failed to set %s: %w", key, err)
+			}
+		} else if err := os.Unsetenv(key); err != nil {
+			return fmt.Errorf("failed to unset %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
 func HasSavedState() bool {
 	_, err := os.Stat(stateFile)
 	return err == nil
@@ -165,11 +230,13 @@ func ExecuteOnLeaveHook() error {
 		return nil // No state, nothing to do
 	}
 
-	if state.OnLeaveHook != "" && state.Directory != "" {
-		if err := ExecuteScript("on_leave", state.OnLeaveHook, state.Directory); err != nil {
-			return fmt.Errorf("on-leave hook failed: %w", err)
-		}
-	}
+	// Background jobs belong to the environment that is being left
+	cancelErr := CancelJobs(state)
 
-	return nil
+	if state.Directory == "" {
+		return cancelErr
+	}
+	// Variables from on_leave have no environment to go into
+	_, err = RunHook(HookOnLeave, state.OnLeave, state.Directory, nil)
+	return errors.Join(cancelErr, err)
 }
@@ -19,6 +19,7 @@ package env
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -84,3 +85,35 @@ func TestStateOperations(t *testing.T) {
 		t.Error("Expected saved state to be removed after restore")
 	}
 }
+
+func TestLoadLegacyOnLeaveHook(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalStateFile := stateFile
+	stateFile = filepath.Join(tmpDir, "test_state.json")
+	defer func() { stateFile = originalStateFile }()
+
+	// Saved before on_leave held the whole hook
+	legacy := `{"environment":{},"aliases":{},"directory":"/project","on_leave_hook":"echo bye"}`
+	if err := os.WriteFile(stateFile, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := LoadSavedState()
+	if err != nil {
+		t.Fatalf("Failed to load saved state: %v", err)
+	}
+	if state.Directory != "/project" || state.OnLeave.Run != "echo bye" {
+		t.Errorf("Expected the legacy on-leave hook to load, got %+v", state)
+	}
+
+	if err := SaveState(state); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"on_leave":{"run":"echo bye"}`) {
+		t.Errorf("Expected the hook saved as on_leave, got %s", data)
+	}
+}
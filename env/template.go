@@ -0,0 +1,172 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+// Template functions that reach outside the direnv process must be listed
+// in the config's template_allow before they can be called.
+const (
+	FuncGitBranch = "gitBranch"
+	FuncFile      = "file"
+)
+
+const gitBranchTimeout = 2 * time.Second
+
+// templateData is the value of "." in config templates.
+type templateData struct {
+	ProjectRoot string
+	Project     string
+	Profile     string
+	File        string
+	GitRoot     string
+	Layers      []string
+}
+
+// isTemplate reports whether value is rendered as a Go template. The output
+// isn't $VAR-expanded afterwards: it holds data the template read, such as
+// a file or a variable, which isn't config syntax.
+func isTemplate(cfg *config.Config, value string) bool {
+	return cfg.Templates && strings.Contains(value, "{{")
+}
+
+// renderConfigValue renders value as a Go template when the config opts in
+// with templates = true. name identifies the value in errors, e.g.
+// "environment.CC", along with the file that defined it.
+func renderConfigValue(cfg *config.Config, ctx *Context, name, value string) (string, error) {
+	if !isTemplate(cfg, value) {
+		return value, nil
+	}
+	file := ctx.File
+	if origin, ok := cfg.Origins[name]; ok {
+		file = origin
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs(cfg, ctx)).Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", file, err)
+	}
+
+	data := templateData{
+		ProjectRoot: ctx.Dir,
+		Project:     ctx.Project,
+		Profile:     ctx.Profile,
+		File:        ctx.File,
+		GitRoot:     ctx.GitRoot,
+		Layers:      ctx.Layers,
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("%s: %w", file, err)
+	}
+	return b.String(), nil
+}
+
+func templateFuncs(cfg *config.Config, ctx *Context) template.FuncMap {
+	allowed := func(name string) error {
+		for _, allow := range cfg.TemplateAllow {
+			if allow == name {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s is not allowed; add it to template_allow", name)
+	}
+
+	return template.FuncMap{
+		"env": func(name string) string {
+			value, _ := ctx.lookup(name)
+			return value
+		},
+		"os":   func() string { return runtime.GOOS },
+		"arch": func() string { return runtime.GOARCH },
+		"hostname": func() (string, error) {
+			return os.Hostname()
+		},
+		"default": func(fallback string, value string) string {
+			if value == "" {
+				return fallback
+			}
+			return value
+		},
+		"join": func(sep string, items ...interface{}) (string, error) {
+			var parts []string
+			for _, item := range items {
+				switch v := item.(type) {
+				case string:
+					parts = append(parts, v)
+				case []string:
+					parts = append(parts, v...)
+				default:
+					return "", fmt.Errorf("join: unsupported argument type %T", item)
+				}
+			}
+			return strings.Join(parts, sep), nil
+		},
+		"sha256": func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"trim":  strings.TrimSpace,
+		FuncGitBranch: func() (string, error) {
+			if err := allowed(FuncGitBranch); err != nil {
+				return "", err
+			}
+			return gitBranch(ctx.Dir)
+		},
+		FuncFile: func(path string) (string, error) {
+			if err := allowed(FuncFile); err != nil {
+				return "", err
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(ctx.Dir, path)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimRight(string(data), "\n"), nil
+		},
+	}
+}
+
+func gitBranch(dir string) (string, error) {
+	timeout, cancel := context.WithTimeout(context.Background(), gitBranchTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(timeout, "git", "-C", dir, "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("gitBranch: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/TierOne-Software/direnv/config"
+	"github.com/TierOne-Software/direnv/shell"
+)
+
+func TestRenderConfigValue(t *testing.T) {
+	t.Setenv("TEMPLATE_USER", "Alice")
+	hostname, _ := os.Hostname()
+
+	cfg := &config.Config{Templates: true}
+	ctx := &Context{Dir: "/project", File: "/project/.direnv.toml", Project: "demo"}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{{ .ProjectRoot }}/build/{{ os }}-{{ arch }}", "/project/build/" + runtime.GOOS + "-" + runtime.GOARCH},
+		{`{{ env "TEMPLATE_USER" | lower }}`, "alice"},
+		{`{{ env "TEMPLATE_UNSET" | default "none" }}`, "none"},
+		{`{{ join "-" .Project os }}`, "demo-" + runtime.GOOS},
+		{`{{ sha256 "abc" }}`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`{{ if eq hostname "` + hostname + `" }}local{{ else }}remote{{ end }}`, "local"},
+		{"no template here", "no template here"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := renderConfigValue(cfg, ctx, "environment.TEST", tt.input)
+			if err != nil {
+				t.Fatalf("renderConfigValue(%q) error: %v", tt.input, err)
+			}
+			if result != tt.expected {
+				t.Errorf("renderConfigValue(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderConfigValueDisabled(t *testing.T) {
+	ctx := &Context{Dir: "/project"}
+	result, err := renderConfigValue(&config.Config{}, ctx, "environment.TEST", "{{ os }}")
+	if err != nil {
+		t.Fatalf("renderConfigValue error: %v", err)
+	}
+	if result != "{{ os }}" {
+		t.Errorf("Expected value to be left alone without templates = true, got %q", result)
+	}
+}
+
+func TestRenderConfigValueErrors(t *testing.T) {
+	ctx := &Context{Dir: t.TempDir(), File: "/project/.direnv.toml"}
+	cfg := &config.Config{Templates: true}
+
+	_, err := renderConfigValue(cfg, ctx, "environment.BROKEN", "{{ nosuchfunc }}")
+	if err == nil {
+		t.Fatal("Expected error for unknown function")
+	}
+	if !strings.Contains(err.Error(), "/project/.direnv.toml") || !strings.Contains(err.Error(), "environment.BROKEN") {
+		t.Errorf("Expected file and key in error, got: %v", err)
+	}
+
+	_, err = renderConfigValue(cfg, ctx, "environment.SECRET", `{{ file "token" }}`)
+	if err == nil || !strings.Contains(err.Error(), "template_allow") {
+		t.Errorf("Expected file to require template_allow, got: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(ctx.Dir, "token"), []byte("abc\n"), 0644); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+	cfg.TemplateAllow = []string{FuncFile}
+	result, err := renderConfigValue(cfg, ctx, "environment.SECRET", `{{ file "token" }}`)
+	if err != nil {
+		t.Fatalf("Expected allowed file() to succeed: %v", err)
+	}
+	if result != "abc" {
+		t.Errorf("Expected file contents, got %q", result)
+	}
+}
+
+func TestExportForShellTemplates(t *testing.T) {
+	cfg := &config.Config{
+		Templates:   true,
+		Environment: map[string]string{"OUT": "{{ .ProjectRoot }}/out/{{ os }}"},
+		Aliases:     map[string]string{"where": "echo {{ .Project }}"},
+		Scripts:     map[string]string{"build": "make -C {{ .ProjectRoot }}"},
+	}
+
+	result, err := ExportForShell(cfg, "/project", shell.DialectFor(shell.Bash))
+	if err != nil {
+		t.Fatalf("ExportForShell failed: %v", err)
+	}
+	for _, want := range []string{
+		"export OUT='/project/out/" + runtime.GOOS + "'",
+		"alias where='echo project'",
+		"make -C /project",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q in output, got: %s", want, result)
+		}
+	}
+}
+
+func TestTemplateOutputIsNotExpanded(t *testing.T) {
+	dir := t.TempDir()
+	data := "cost $$5 in $HOME, ${MISSING:?not a reference}"
+	if err := os.WriteFile(filepath.Join(dir, "data"), []byte(data+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+
+	cfg := &config.Config{
+		Templates:     true,
+		TemplateAllow: []string{FuncFile},
+		Environment: map[string]string{
+			"DATA":  `{{ file "data" }}`,
+			"PLAIN": "$HOME",
+		},
+	}
+	values, err := buildEnvironment(cfg, NewContext(cfg, dir))
+	if err != nil {
+		t.Fatalf("buildEnvironment failed: %v", err)
+	}
+	if values["DATA"] != data {
+		t.Errorf("Expected the file verbatim, got %q", values["DATA"])
+	}
+	if values["PLAIN"] != os.Getenv("HOME") {
+		t.Errorf("Expected values without templates to be expanded, got %q", values["PLAIN"])
+	}
+}
+
+func TestTemplateErrorsNameDefiningFile(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, config.ConfigFileName)
+	local := filepath.Join(dir, config.LocalConfigFileName)
+	if err := os.WriteFile(base, []byte("templates = true\n[environment]\nGOOD = \"{{ os }}\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(local, []byte("[environment]\nBROKEN = \"{{ nosuchfunc }}\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.LoadProjectConfig(base)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	_, err = buildEnvironment(cfg, NewContext(cfg, dir))
+	if err == nil || !strings.Contains(err.Error(), local+":") {
+		t.Errorf("Expected the error to name %s, got: %v", local, err)
+	}
+}
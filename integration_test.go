@@ -17,6 +17,7 @@
 package main
 
 import (
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -89,3 +90,601 @@ hello = "echo Hello from direnv script"
 		t.Errorf("Expected script output, got: %s", output)
 	}
 }
+
+func TestBashPromptHook(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	originalDir, _ := os.Getwd()
+	tmpDir := t.TempDir()
+	projectDir := filepath.Join(tmpDir, "project")
+	subDir := filepath.Join(projectDir, "src", "pkg")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	configContent := `
+[environment]
+HOOK_VAR = "from_hook"
+`
+	if err := os.WriteFile(filepath.Join(projectDir, ".direnv.toml"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	// The prompt hook must notice a directory change made inside a
+	// function and find the config in a parent directory
+	script := `
+PROMPT_COMMAND=(existing)
+eval "$(direnv hook bash)"
+echo "prompt: ${PROMPT_COMMAND[*]}"
+complete -p direnv
+go_deep() { cd "$1"; }
+go_deep ` + subDir + `
+_direnv_hook
+echo "entered: ${HOOK_VAR-unset}"
+echo "again: [$(direnv export bash)]"
+cd /
+_direnv_hook
+echo "left: ${HOOK_VAR-unset}"
+`
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-c", script)
+	cmd.Env = append(os.Environ(),
+		"HOME="+tmpDir,
+		"PATH="+originalDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"DIRENV_AUTO_APPLY=1",
+		"DIRENV_SHELL=bash",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash failed: %v\nOutput: %s", err, output)
+	}
+
+	for _, want := range []string{
+		"prompt: _direnv_hook existing\n",
+		"complete -F _direnv direnv\n",
+		"entered: from_hook\n",
+		"again: []\n",
+		"left: unset\n",
+	} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Expected %q in output, got: %s", want, output)
+		}
+	}
+}
+
+func TestDetectParentShell(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	originalDir, _ := os.Getwd()
+	direnvBinary := filepath.Join(originalDir, "direnv")
+
+	// The running shell wins over the login shell; the trailing command
+	// keeps bash from replacing itself with direnv
+	run := func(args ...string) string {
+		t.Helper()
+		script := `"` + direnvBinary + `" ` + strings.Join(args, " ") + `; true`
+		cmd := exec.Command("bash", "--norc", "--noprofile", "-c", script)
+		cmd.Env = append(os.Environ(), "SHELL=/bin/zsh", "DIRENV_SHELL=")
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("direnv %v failed: %v\nOutput: %s", args, err, output)
+		}
+		return string(output)
+	}
+
+	if output := run("init"); !strings.Contains(output, "export DIRENV_SHELL=bash") {
+		t.Errorf("Expected the bash init script, got: %s", output)
+	}
+	if output := run("init", "--shell", "fish"); !strings.Contains(output, "set -gx DIRENV_SHELL fish") {
+		t.Errorf("Expected --shell to override detection, got: %s", output)
+	}
+	if output := run("init", "--shell", "fsh"); !strings.Contains(output, "unsupported shell: fsh (supported: ") || strings.Contains(output, "DIRENV_SHELL") {
+		t.Errorf("Expected --shell to reject an unknown shell, got: %s", output)
+	}
+}
+
+func TestUnsupportedShellArgument(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	originalDir, _ := os.Getwd()
+	direnvBinary := filepath.Join(originalDir, "direnv")
+
+	for _, command := range []string{"init", "hook", "completion"} {
+		output, err := exec.Command(direnvBinary, command, "fsh").CombinedOutput()
+		if err == nil {
+			t.Errorf("Expected direnv %s fsh to fail, got: %s", command, output)
+		}
+		if !strings.Contains(string(output), "unsupported shell: fsh (supported: ") {
+			t.Errorf("Expected direnv %s fsh to name the unsupported shell, got: %s", command, output)
+		}
+	}
+}
+
+func TestChildShellInheritsSession(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	originalDir, _ := os.Getwd()
+	tmpDir := t.TempDir()
+	projectDir := filepath.Join(tmpDir, "project")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, ".direnv.toml"), []byte("[environment]\nSESSION_VAR = \"set\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	// A child shell, like a tmux pane, inherits the applied environment
+	// and must be able to restore it without affecting its parent
+	child := `
+eval "$(direnv hook bash)"
+direnv info | grep Session
+eval "$(direnv restore 2>/dev/null)"
+echo "child: ${SESSION_VAR-unset}"
+`
+	parent := `
+eval "$(direnv hook bash)"
+cd ` + projectDir + `
+_direnv_hook
+bash --norc --noprofile -c '` + child + `'
+echo "parent: ${SESSION_VAR-unset}"
+direnv info | grep 'Active environment'
+`
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-c", parent)
+	cmd.Env = append(os.Environ(),
+		"HOME="+tmpDir,
+		"PATH="+originalDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"DIRENV_AUTO_APPLY=1",
+		"DIRENV_SESSION=",
+		"DIRENV_SHELL_PID=",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash failed: %v\nOutput: %s", err, output)
+	}
+
+	for _, want := range []string{
+		"(inherited from ",
+		"child: unset\n",
+		"parent: set\n",
+		"Active environment: " + projectDir,
+	} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Expected %q in output, got: %s", want, output)
+		}
+	}
+}
+
+func TestAutoApplySettings(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	originalDir, _ := os.Getwd()
+	tmpDir := t.TempDir()
+	enabledDir := filepath.Join(tmpDir, "enabled")
+	otherDir := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{enabledDir, otherDir} {
+		if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+			t.Fatalf("Failed to create directories: %v", err)
+		}
+		configContent := "[environment]\nSETTING_VAR = \"" + filepath.Base(dir) + "\"\n"
+		if err := os.WriteFile(filepath.Join(dir, ".direnv.toml"), []byte(configContent), 0644); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+	}
+
+	// Only the directory enabled with --here applies by itself, and an
+	// environment applied by hand isn't unloaded by the hook
+	script := `
+eval "$(direnv hook bash)"
+cd ` + enabledDir + ` && direnv enable --here
+cd sub
+_direnv_hook
+echo "enabled: ${SETTING_VAR-unset}"
+cd /
+_direnv_hook
+echo "left: ${SETTING_VAR-unset}"
+cd ` + otherDir + `
+_direnv_hook
+echo "other: ${SETTING_VAR-unset}"
+direnv-apply >/dev/null
+cd /
+_direnv_hook
+echo "manual: ${SETTING_VAR-unset}"
+`
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-c", script)
+	cmd.Env = []string{
+		"HOME=" + tmpDir,
+		"PATH=" + originalDir + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"DIRENV_SHELL=bash",
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash failed: %v\nOutput: %s", err, output)
+	}
+
+	for _, want := range []string{
+		"Auto-apply enabled for " + enabledDir + " and below\n",
+		"enabled: enabled\n",
+		"left: unset\n",
+		"other: unset\n",
+		"manual: other\n",
+	} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Expected %q in output, got: %s", want, output)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	originalDir, _ := os.Getwd()
+	tmpDir := t.TempDir()
+	projectDir := filepath.Join(tmpDir, "project")
+	if err := os.MkdirAll(filepath.Join(projectDir, "migrations"), 0755); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	for _, name := range []string{"001_init.sql", "002_users.sql"} {
+		if err := os.WriteFile(filepath.Join(projectDir, "migrations", name), nil, 0644); err != nil {
+			t.Fatalf("Failed to write migration: %v", err)
+		}
+	}
+	configContent := `
+[scripts]
+build = "make"
+
+[scripts.deploy]
+run = "echo deploying to $1"
+complete = ["staging", "prod"]
+
+[scripts.migrate]
+run = "echo migrating $1"
+complete_command = "ls migrations/"
+
+[services.db]
+run = "sleep 60"
+`
+	if err := os.WriteFile(filepath.Join(projectDir, ".direnv.toml"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	// Completion is asked for as bash would, from the line before the
+	// cursor, both through direnv and the exported script functions
+	script := `
+eval "$(direnv hook bash)"
+eval "$(direnv apply 2>/dev/null)"
+try() {
+    COMP_LINE="$1"
+    COMP_POINT=${#COMP_LINE}
+    "$2"
+    echo "[$1] ${COMPREPLY[*]}"
+}
+try "direnv do" _direnv
+try "direnv run " _direnv
+try "direnv run deploy " _direnv
+try "direnv --shell=z" _direnv
+try "direnv logs --f" _direnv
+try "direnv up " _direnv
+try "deploy p" _direnv_script
+try "migrate 00" _direnv_script
+`
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-c", script)
+	cmd.Dir = projectDir
+	cmd.Env = append(os.Environ(),
+		"HOME="+tmpDir,
+		"PATH="+originalDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"DIRENV_SHELL=bash",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash failed: %v\nOutput: %s", err, output)
+	}
+
+	for _, want := range []string{
+		"[direnv do] doctor down\n",
+		"[direnv run ] build deploy migrate\n",
+		"[direnv run deploy ] staging prod\n",
+		"[direnv --shell=z] zsh\n",
+		"[direnv logs --f] --follow\n",
+		"[direnv up ] db\n",
+		"[deploy p] prod\n",
+		"[migrate 00] 001_init.sql 002_users.sql\n",
+	} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Expected %q in output, got: %s", want, output)
+		}
+	}
+
+	// A script without declared completion leaves it to file names
+	complete := exec.Command(filepath.Join(originalDir, "direnv"), "__complete", "--current=", "run", "build")
+	complete.Dir = projectDir
+	complete.Env = append(os.Environ(), "HOME="+tmpDir)
+	if output, err := complete.Output(); err != nil || string(output) != ":files\n" {
+		t.Errorf("Expected a request for file names, got %q, %v", output, err)
+	}
+}
+
+func TestHookOverrideKeepsConfigCurrent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	originalDir, _ := os.Getwd()
+	tmpDir := t.TempDir()
+	projectDir := filepath.Join(tmpDir, "project")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	marker := filepath.Join(tmpDir, "config-changed")
+	configContent := `
+[environment]
+MODE = "base"
+
+[hooks]
+post_apply = 'echo MODE=hook >> "$DIRENV_ENV_FILE"'
+on_config_change = "touch ` + marker + `"
+`
+	if err := os.WriteFile(filepath.Join(projectDir, ".direnv.toml"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	// The hook's value replaces the config's, which must not make the
+	// applied config look changed on the next prompt or apply
+	script := `
+eval "$(direnv hook bash)"
+cd ` + projectDir + `
+_direnv_hook
+echo "mode: $MODE"
+echo "again: [$(direnv export bash)]"
+eval "$(direnv apply 2>/dev/null)"
+echo "reapplied: $MODE"
+`
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-c", script)
+	cmd.Env = append(os.Environ(),
+		"HOME="+tmpDir,
+		"PATH="+originalDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"DIRENV_AUTO_APPLY=1",
+		"DIRENV_SHELL=bash",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash failed: %v\nOutput: %s", err, output)
+	}
+
+	for _, want := range []string{"mode: hook\n", "again: []\n", "reapplied: hook\n"} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Expected %q in output, got: %s", want, output)
+		}
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected on_config_change not to run for an unchanged config")
+	}
+}
+
+func TestOnLeaveRunsBeforeEntering(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	originalDir, _ := os.Getwd()
+	tmpDir := t.TempDir()
+	logFile := filepath.Join(tmpDir, "hooks.log")
+	hooks := map[string]string{
+		"a": `on_leave = "echo leave a >> ` + logFile + `"`,
+		"b": `on_enter = "echo enter b >> ` + logFile + `"`,
+	}
+	for name, hook := range hooks {
+		dir := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directories: %v", err)
+		}
+		configContent := `
+[hooks]
+` + hook + `
+`
+		if err := os.WriteFile(filepath.Join(dir, ".direnv.toml"), []byte(configContent), 0644); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+	}
+
+	// Re-applying a doesn't leave it; moving to b leaves a first
+	script := `
+cd ` + filepath.Join(tmpDir, "a") + `
+eval "$(direnv apply 2>/dev/null)"
+eval "$(direnv apply 2>/dev/null)"
+cd ` + filepath.Join(tmpDir, "b") + `
+eval "$(direnv apply 2>/dev/null)"
+`
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-c", script)
+	cmd.Env = append(os.Environ(),
+		"HOME="+tmpDir,
+		"PATH="+originalDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"DIRENV_SHELL=bash",
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("bash failed: %v\nOutput: %s", err, output)
+	}
+
+	log, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read hook log: %v", err)
+	}
+	if string(log) != "leave a\nenter b\n" {
+		t.Errorf("Unexpected hook order:\n%s", log)
+	}
+}
+
+func TestFailingSourceOnlyBreaksApply(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	originalDir, _ := os.Getwd()
+	tmpDir := t.TempDir()
+	configContent := "[environment]\nPLAIN = \"ok\"\nBROKEN = { command = \"exit 3\" }\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ".direnv.toml"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	// Inspecting the project doesn't run its sources; doctor reports them
+	script := `
+cd ` + tmpDir + `
+direnv info >/dev/null && echo "info: ok"
+direnv diff | grep BROKEN
+direnv doctor | grep "Source failed"
+direnv apply >/dev/null 2>&1 || echo "apply: failed"
+`
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-c", script)
+	cmd.Env = []string{
+		"HOME=" + tmpDir,
+		"PATH=" + originalDir + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"DIRENV_SHELL=bash",
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash failed: %v\nOutput: %s", err, output)
+	}
+
+	for _, want := range []string{
+		"info: ok\n",
+		"BROKEN",
+		"<command>",
+		"Source failed: environment variable BROKEN",
+		"apply: failed\n",
+	} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Expected %q in output, got: %s", want, output)
+		}
+	}
+}
+
+func TestRestoreOutlastsAutoApply(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	originalDir, _ := os.Getwd()
+	tmpDir := t.TempDir()
+	projectDir := filepath.Join(tmpDir, "project")
+	if err := os.MkdirAll(filepath.Join(projectDir, "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, ".direnv.toml"), []byte("[environment]\nRESTORE_VAR = \"set\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	// A restore holds while the shell stays in the project, and ends when it
+	// leaves or applies by hand
+	script := `
+eval "$(direnv hook bash)"
+cd ` + projectDir + `
+_direnv_hook
+echo "entered: ${RESTORE_VAR-unset}"
+direnv-restore 2>/dev/null
+cd sub
+_direnv_hook
+echo "restored: ${RESTORE_VAR-unset}"
+cd /
+_direnv_hook
+cd ` + projectDir + `
+_direnv_hook
+echo "returned: ${RESTORE_VAR-unset}"
+direnv-restore 2>/dev/null
+_direnv_hook
+echo "held: ${RESTORE_VAR-unset}"
+direnv-apply >/dev/null 2>&1
+_direnv_hook
+echo "applied: ${RESTORE_VAR-unset}"
+`
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-c", script)
+	cmd.Env = []string{
+		"HOME=" + tmpDir,
+		"PATH=" + originalDir + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"DIRENV_SHELL=bash",
+		"DIRENV_AUTO_APPLY=1",
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash failed: %v\nOutput: %s", err, output)
+	}
+
+	for _, want := range []string{
+		"entered: set\n",
+		"restored: unset\n",
+		"returned: set\n",
+		"held: unset\n",
+		"applied: set\n",
+	} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Expected %q in output, got: %s", want, output)
+		}
+	}
+}
+
+func TestPromptJSONWhenStatusUnreadable(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	originalDir, _ := os.Getwd()
+	tmpDir := t.TempDir()
+	stateDir := filepath.Join(tmpDir, ".config", "direnv")
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		t.Fatalf("Failed to create state directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(stateDir, "state_4242.json"), []byte("{not json"), 0600); err != nil {
+		t.Fatalf("Failed to write state: %v", err)
+	}
+
+	// Frameworks parse the output of every prompt
+	cmd := exec.Command(filepath.Join(originalDir, "direnv"), "prompt", "--json")
+	cmd.Env = []string{"HOME=" + tmpDir, "DIRENV_SHELL_PID=4242"}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("direnv prompt failed: %v\nOutput: %s", err, output)
+	}
+
+	var status map[string]interface{}
+	if err := json.Unmarshal(output, &status); err != nil {
+		t.Fatalf("Expected a JSON document, got %q: %v", output, err)
+	}
+	if status["active"] != false || status["session"] != "4242" {
+		t.Errorf("Expected the inactive status of session 4242, got %s", output)
+	}
+}
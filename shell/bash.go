@@ -0,0 +1,173 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bourne implements what bash, zsh and POSIX sh share.
+type bourne struct{}
+
+func (bourne) Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "'\"'\"'") + "'"
+}
+
+func (b bourne) SetVar(name, value string) string {
+	return fmt.Sprintf("export %s=%s", name, b.Quote(value))
+}
+
+func (bourne) UnsetVar(name string) string {
+	return fmt.Sprintf("unset %s", name)
+}
+
+func (b bourne) DefineAlias(name, command string) string {
+	return fmt.Sprintf("alias %s=%s", name, b.Quote(command))
+}
+
+func (bourne) RemoveAlias(name string) string {
+	return fmt.Sprintf("unalias %s 2>/dev/null", name)
+}
+
+func (bourne) RemoveFunction(name string) string {
+	return fmt.Sprintf("unset -f %s", name)
+}
+
+// localFunction defines a function for bash and zsh, which have local.
+func (b bourne) localFunction(name, script, projectRoot string) string {
+	// Inject PROJECT_ROOT into the function and pass all arguments
+	return fmt.Sprintf("%s() {\n    local PROJECT_ROOT=%s\n    (\n        cd \"$PROJECT_ROOT\"\n        set -- \"$@\"\n%s\n    )\n}", name, b.Quote(projectRoot), indent(script, "        "))
+}
+
+type bash struct{ bourne }
+
+func (b bash) DefineFunction(name, script, projectRoot string) string {
+	return b.localFunction(name, script, projectRoot) + fmt.Sprintf("\ncomplete -F _direnv_script %s", name)
+}
+
+func (b bash) RemoveFunction(name string) string {
+	return b.bourne.RemoveFunction(name) + fmt.Sprintf("\ncomplete -r %s 2>/dev/null", name)
+}
+
+func (bash) InitScript() string {
+	return bashInitScript
+}
+
+func (bash) CompletionScript() string {
+	return bashCompletionScript
+}
+
+const bashInitScript = `# direnv - Directory Environment Manager
+# Add this to your ~/.bashrc
+
+export DIRENV_SHELL=bash
+# Identifies this shell to direnv, also from subshells and pipelines
+export DIRENV_SHELL_PID=$$
+
+# Runs before every prompt, so directory changes from functions, autocd or
+# tools like zoxide are noticed too. direnv decides whether to apply, unload
+# or do nothing.
+_direnv_hook() {
+    local previous_exit_status=$?
+    trap -- '' SIGINT
+    eval "$(direnv export bash)"
+    trap - SIGINT
+    return $previous_exit_status
+}
+
+# Keep existing PROMPT_COMMAND entries, including the array form of bash 5.1+
+if [[ ";$(IFS=';'; echo "${PROMPT_COMMAND[*]:-}");" != *";_direnv_hook;"* ]]; then
+    if [[ "$(declare -p PROMPT_COMMAND 2>/dev/null)" == "declare -a"* ]]; then
+        PROMPT_COMMAND=(_direnv_hook "${PROMPT_COMMAND[@]}")
+    else
+        PROMPT_COMMAND="_direnv_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+    fi
+fi
+
+direnv-apply() {
+    eval "$(direnv apply)"
+}
+
+direnv-restore() {
+    eval "$(direnv restore)"
+}
+
+direnv-info() {
+    direnv info
+}
+
+direnv-enable() {
+    direnv enable "$@"
+}
+
+direnv-disable() {
+    direnv disable "$@"
+}
+
+# Load completions if available
+if command -v direnv >/dev/null 2>&1; then
+    eval "$(direnv completion bash 2>/dev/null)"
+fi
+`
+
+const bashCompletionScript = `# direnv bash completion
+# Candidates come from direnv __complete, which knows every command, flag
+# and script. ":files" asks for file names instead.
+_direnv_candidates() {
+    local cur="$1" prefix="" candidate
+    shift
+    # Bash replaces the word after "=" only
+    if [[ "$cur" == *=* ]]; then
+        prefix="${cur%=*}="
+    fi
+    COMPREPLY=()
+    while IFS= read -r candidate; do
+        if [[ "$candidate" == :files ]]; then
+            compopt -o default 2>/dev/null
+        else
+            candidate="${candidate%%$'\t'*}"
+            COMPREPLY+=("${candidate#"$prefix"}")
+        fi
+    done < <(direnv __complete "--current=$cur" "$@" 2>/dev/null)
+}
+
+# Sets words to the words before the cursor, the one being completed last.
+# COMP_WORDS would also split at "=".
+_direnv_words() {
+    local line="${COMP_LINE:0:COMP_POINT}"
+    read -ra words <<< "$line"
+    if [[ -z "$line" || "$line" == *[[:space:]] ]]; then
+        words+=("")
+    fi
+}
+
+_direnv() {
+    local words
+    _direnv_words
+    _direnv_candidates "${words[${#words[@]}-1]}" "${words[@]:1:${#words[@]}-2}"
+}
+
+# Completes a script exported as a function like direnv run <script>
+_direnv_script() {
+    local words
+    _direnv_words
+    _direnv_candidates "${words[${#words[@]}-1]}" run "${words[@]:0:${#words[@]}-1}"
+}
+
+complete -F _direnv direnv
+`
@@ -17,28 +17,120 @@
 package shell
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 )
 
 type ShellType string
 
 const (
-	Bash    ShellType = "bash"
-	Zsh     ShellType = "zsh"
-	Fish    ShellType = "fish"
-	Unknown ShellType = "unknown"
+	Bash       ShellType = "bash"
+	Zsh        ShellType = "zsh"
+	Fish       ShellType = "fish"
+	Nushell    ShellType = "nu"
+	PowerShell ShellType = "pwsh"
+	Posix      ShellType = "sh"   // sh, dash, busybox ash, ksh and mksh
+	Tcsh       ShellType = "tcsh" // tcsh and csh
+	Unknown    ShellType = "unknown"
 )
 
+// maxAncestors bounds the search for a shell among direnv's ancestors, which
+// skips wrappers such as sudo, env or make.
+const maxAncestors = 4
+
+// override is the shell named with --shell.
+var override ShellType
+
+// parentShell finds the shell running direnv; tests replace it.
+var parentShell = findParentShell
+
+// SetOverride makes Detect return shellType, from the --shell flag, or
+// clears the override if shellType is "".
+func SetOverride(shellType ShellType) error {
+	if shellType != "" && !shellType.IsSupported() {
+		return UnsupportedError(shellType)
+	}
+	override = shellType
+	return nil
+}
+
+// Detection holds what each source says about the shell, for diagnostics.
+type Detection struct {
+	Override ShellType
+	// Parent is the nearest shell among direnv's ancestors, at ParentPath
+	Parent     ShellType
+	ParentPath string
+	// Integration is DIRENV_SHELL, exported by the init scripts
+	Integration ShellType
+	// Login is $SHELL, the login shell
+	Login ShellType
+}
+
+// Inspect consults all sources of the shell.
+func Inspect() Detection {
+	d := Detection{
+		Override:    override,
+		Integration: Unknown,
+		Login:       FromPath(os.Getenv("SHELL")),
+	}
+	d.Parent, d.ParentPath = parentShell()
+	if name := os.Getenv("DIRENV_SHELL"); name != "" {
+		d.Integration = ShellType(name)
+	}
+	return d
+}
+
+// Shell returns the shell to generate code for: --shell, then the parent
+// process, which is the shell actually running, then DIRENV_SHELL, and
+// last $SHELL, which names the login shell rather than the one running.
+func (d Detection) Shell() ShellType {
+	for _, shellType := range []ShellType{d.Override, d.Parent, d.Integration} {
+		if shellType.IsSupported() {
+			return shellType
+		}
+	}
+	return d.Login
+}
+
+// Detect returns the shell to generate code for.
 func Detect() ShellType {
-	shellEnv := os.Getenv("SHELL")
-	if shellEnv == "" {
+	if override != "" {
+		return override
+	}
+	return Inspect().Shell()
+}
+
+// findParentShell returns the type and path of the nearest supported shell
+// among direnv's ancestors.
+func findParentShell() (ShellType, string) {
+	pid := os.Getppid()
+	for i := 0; i < maxAncestors && pid > 1; i++ {
+		exe, comm, ppid, err := processInfo(pid)
+		if err != nil {
+			break
+		}
+		// busybox is the executable of all its applets, not only of sh
+		if shellType := FromPath(exe); shellType.IsSupported() && filepath.Base(exe) != "busybox" {
+			return shellType, exe
+		}
+		// Login shells are named with a leading dash, e.g. -bash
+		if shellType := FromPath(strings.TrimPrefix(comm, "-")); shellType.IsSupported() {
+			return shellType, comm
+		}
+		pid = ppid
+	}
+	return Unknown, ""
+}
+
+// FromPath returns the type of the shell binary at path.
+func FromPath(path string) ShellType {
+	if path == "" {
 		return Unknown
 	}
 
-	shellName := filepath.Base(shellEnv)
+	shellName := filepath.Base(path)
 
 	switch {
 	case strings.Contains(shellName, "bash"):
@@ -47,11 +139,35 @@ func Detect() ShellType {
 		return Zsh
 	case strings.Contains(shellName, "fish"):
 		return Fish
+	case shellName == "nu" || strings.Contains(shellName, "nushell"):
+		return Nushell
+	case strings.Contains(shellName, "pwsh") || strings.Contains(shellName, "powershell"):
+		return PowerShell
+	case shellName == "tcsh" || shellName == "csh":
+		return Tcsh
+	case isPosixShell(shellName):
+		return Posix
 	default:
 		return Unknown
 	}
 }
 
+// isPosixShell reports whether shellName is a shell that only gets POSIX
+// sh code: sh itself, dash, busybox and the Korn shells.
+func isPosixShell(shellName string) bool {
+	switch shellName {
+	case "sh", "dash", "ash", "busybox":
+		return true
+	}
+	return strings.HasSuffix(shellName, "ksh") || strings.HasPrefix(shellName, "ksh")
+}
+
+// IsSupported reports whether direnv can generate code for the shell.
+func (s ShellType) IsSupported() bool {
+	_, ok := dialects[s]
+	return ok
+}
+
 func GetConfigFile(shellType ShellType) string {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -65,26 +181,36 @@ func GetConfigFile(shellType ShellType) string {
 		return filepath.Join(homeDir, ".zshrc")
 	case Fish:
 		return filepath.Join(homeDir, ".config", "fish", "config.fish")
+	case Nushell:
+		// nushell keeps its config in the platform's config directory
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return ""
+		}
+		return filepath.Join(configDir, "nushell", "config.nu")
+	case Tcsh:
+		// tcsh falls back to ~/.cshrc when there's no ~/.tcshrc
+		tcshrc := filepath.Join(homeDir, ".tcshrc")
+		cshrc := filepath.Join(homeDir, ".cshrc")
+		if _, err := os.Stat(tcshrc); os.IsNotExist(err) {
+			if _, err := os.Stat(cshrc); err == nil {
+				return cshrc
+			}
+		}
+		return tcshrc
+	case Posix:
+		// Interactive POSIX shells read the file named by $ENV
+		if envFile := os.Getenv("ENV"); envFile != "" {
+			return envFile
+		}
+		return filepath.Join(homeDir, ".shrc")
+	case PowerShell:
+		// $PROFILE for the current user and host
+		if runtime.GOOS == "windows" {
+			return filepath.Join(homeDir, "Documents", "PowerShell", "Microsoft.PowerShell_profile.ps1")
+		}
+		return filepath.Join(homeDir, ".config", "powershell", "Microsoft.PowerShell_profile.ps1")
 	default:
 		return ""
 	}
 }
-
-func SetAutoApply(enabled bool) error {
-	// For environment variable approach, we just give instructions
-	if enabled {
-		fmt.Println("To enable auto-apply, run:")
-		fmt.Println("  export DIRENV_AUTO_APPLY=1")
-		fmt.Println("Add this to your shell config (~/.bashrc or ~/.zshrc) to make it permanent.")
-	} else {
-		fmt.Println("To disable auto-apply, run:")
-		fmt.Println("  export DIRENV_AUTO_APPLY=0")
-		fmt.Println("Or remove the variable entirely with: unset DIRENV_AUTO_APPLY")
-	}
-	return nil
-}
-
-func IsAutoApplyEnabled() bool {
-	autoApply := os.Getenv("DIRENV_AUTO_APPLY")
-	return autoApply == "1"
-}
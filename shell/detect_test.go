@@ -18,6 +18,8 @@ package shell
 
 import (
 	"os"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -31,12 +33,23 @@ func TestDetect(t *testing.T) {
 		{"/bin/zsh", Zsh},
 		{"/usr/bin/zsh", Zsh},
 		{"/usr/local/bin/fish", Fish},
-		{"/bin/sh", Unknown},
+		{"/usr/bin/nu", Nushell},
+		{"/usr/bin/pwsh", PowerShell},
+		{"/opt/microsoft/powershell/7/pwsh-preview", PowerShell},
+		{"/bin/sh", Posix},
+		{"/bin/dash", Posix},
+		{"/bin/mksh", Posix},
+		{"/usr/bin/ksh93", Posix},
+		{"/bin/tcsh", Tcsh},
+		{"/bin/csh", Tcsh},
+		{"/usr/bin/elvish", Unknown},
 		{"", Unknown},
 	}
 
 	originalShell := os.Getenv("SHELL")
 	defer os.Setenv("SHELL", originalShell)
+	t.Setenv("DIRENV_SHELL", "")
+	withoutParentShell(t)
 
 	for _, tt := range tests {
 		t.Run(tt.shellPath, func(t *testing.T) {
@@ -54,6 +67,21 @@ func TestDetect(t *testing.T) {
 	}
 }
 
+func TestDetectPrefersDirenvShell(t *testing.T) {
+	t.Setenv("SHELL", "/bin/bash")
+	withoutParentShell(t)
+
+	t.Setenv("DIRENV_SHELL", "nu")
+	if result := Detect(); result != Nushell {
+		t.Errorf("Detect() = %v, want %v", result, Nushell)
+	}
+
+	t.Setenv("DIRENV_SHELL", "cmd.exe")
+	if result := Detect(); result != Bash {
+		t.Errorf("Detect() = %v, want %v for an unsupported DIRENV_SHELL", result, Bash)
+	}
+}
+
 func TestGetConfigFile(t *testing.T) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -67,7 +95,12 @@ func TestGetConfigFile(t *testing.T) {
 		{Bash, ".bashrc"},
 		{Zsh, ".zshrc"},
 		{Fish, ".config/fish/config.fish"},
+		{Nushell, "nushell/config.nu"},
+		{PowerShell, "Microsoft.PowerShell_profile.ps1"},
+		{Posix, ".shrc"},
+		{Tcsh, "rc"},
 	}
+	t.Setenv("ENV", "")
 
 	for _, tt := range tests {
 		t.Run(string(tt.shellType), func(t *testing.T) {
@@ -81,3 +114,57 @@ func TestGetConfigFile(t *testing.T) {
 		})
 	}
 }
+
+// withoutParentShell makes Detect ignore the shell running the tests.
+func withoutParentShell(t *testing.T) {
+	t.Helper()
+	original := parentShell
+	parentShell = func() (ShellType, string) { return Unknown, "" }
+	t.Cleanup(func() { parentShell = original })
+}
+
+func TestDetectionOrder(t *testing.T) {
+	t.Setenv("SHELL", "/bin/bash")
+	t.Setenv("DIRENV_SHELL", "zsh")
+	original := parentShell
+	parentShell = func() (ShellType, string) { return Fish, "/usr/bin/fish" }
+	defer func() { parentShell = original }()
+
+	d := Inspect()
+	if d.Parent != Fish || d.ParentPath != "/usr/bin/fish" || d.Integration != Zsh || d.Login != Bash {
+		t.Errorf("Unexpected detection: %+v", d)
+	}
+	if result := Detect(); result != Fish {
+		t.Errorf("Detect() = %v, want the parent shell %v", result, Fish)
+	}
+
+	SetOverride(Tcsh)
+	defer SetOverride("")
+	if result := Detect(); result != Tcsh {
+		t.Errorf("Detect() = %v, want the override %v", result, Tcsh)
+	}
+
+	err := SetOverride("fsh")
+	if err == nil || !strings.Contains(err.Error(), "supported: bash, fish") {
+		t.Errorf("Expected an error listing the supported shells, got %v", err)
+	}
+	if result := Detect(); result != Tcsh {
+		t.Errorf("Detect() = %v after a rejected override, want %v", result, Tcsh)
+	}
+}
+
+func TestProcessInfo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process inspection is not supported on Windows")
+	}
+	exe, comm, ppid, err := processInfo(os.Getpid())
+	if err != nil {
+		t.Fatalf("processInfo failed: %v", err)
+	}
+	if ppid != os.Getppid() {
+		t.Errorf("Expected parent PID %d, got %d", os.Getppid(), ppid)
+	}
+	if exe == "" || comm == "" {
+		t.Errorf("Expected executable and command, got %q and %q", exe, comm)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Dialect generates the code direnv prints for one shell: the exports and
+// unloads it evaluates, its init hook and its completion. Supporting a new
+// shell means implementing Dialect and registering it in dialects.
+type Dialect interface {
+	// Quote returns s as one word the shell reads back verbatim.
+	Quote(s string) string
+
+	SetVar(name, value string) string
+	UnsetVar(name string) string
+
+	DefineAlias(name, command string) string
+	// RemoveAlias returns "" if the shell can't remove an alias.
+	RemoveAlias(name string) string
+
+	// DefineFunction defines a command running script, which is POSIX shell
+	// code, from projectRoot with the command's arguments.
+	DefineFunction(name, script, projectRoot string) string
+	// RemoveFunction returns "" if the shell can't remove a function.
+	RemoveFunction(name string) string
+
+	// InitScript loads the completion at its end, in a block starting with
+	// completionLoader, unless it includes the completion itself.
+	InitScript() string
+	CompletionScript() string
+}
+
+// completionLoader starts the block of an init script that loads the
+// output of direnv completion.
+const completionLoader = "\n# Load completions"
+
+// Finisher is implemented by dialects whose shell can't consume the export
+// as a sequence of lines. Finish turns the lines into what it consumes.
+type Finisher interface {
+	Finish(code string) (string, error)
+}
+
+var dialects = map[ShellType]Dialect{
+	Bash:       bash{},
+	Zsh:        zsh{},
+	Fish:       fish{},
+	Nushell:    nushell{},
+	PowerShell: powershell{},
+	Posix:      posix{},
+	Tcsh:       tcsh{},
+}
+
+// Lookup returns the dialect of a supported shell.
+func Lookup(shellType ShellType) (Dialect, bool) {
+	d, ok := dialects[shellType]
+	return d, ok
+}
+
+// Supported returns the shells with a dialect, sorted by name.
+func Supported() []ShellType {
+	shells := make([]ShellType, 0, len(dialects))
+	for shellType := range dialects {
+		shells = append(shells, shellType)
+	}
+	sort.Slice(shells, func(i, j int) bool { return shells[i] < shells[j] })
+	return shells
+}
+
+// UnsupportedError reports that direnv has no dialect for shellType and
+// lists the shells it has one for.
+func UnsupportedError(shellType ShellType) error {
+	names := make([]string, 0, len(dialects))
+	for _, s := range Supported() {
+		names = append(names, string(s))
+	}
+	return fmt.Errorf("unsupported shell: %s (supported: %s)", shellType, strings.Join(names, ", "))
+}
+
+// DialectFor returns the dialect of shellType. Unknown shells get bash's,
+// whose exports most shells derived from sh understand.
+func DialectFor(shellType ShellType) Dialect {
+	if d, ok := Lookup(shellType); ok {
+		return d
+	}
+	return bash{}
+}
+
+// Finish returns code, built from the dialect's lines, as its shell
+// consumes it.
+func Finish(d Dialect, code string) (string, error) {
+	if f, ok := d.(Finisher); ok {
+		return f.Finish(code)
+	}
+	return code, nil
+}
+
+func indent(s string, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,294 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPosixQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"simple", "'simple'"},
+		{"with spaces", "'with spaces'"},
+		{"with'quote", "'with'\"'\"'quote'"},
+		{"", "''"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := DialectFor(Bash).Quote(tt.input)
+			if result != tt.expected {
+				t.Errorf("Quote(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFishQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"simple", "'simple'"},
+		{"with'quote", `'with\'quote'`},
+		{`back\slash`, `'back\\slash'`},
+		{"$HOME (x)", "'$HOME (x)'"},
+		{"", "''"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := DialectFor(Fish).Quote(tt.input)
+			if result != tt.expected {
+				t.Errorf("Quote(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPowerShellQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"simple", "'simple'"},
+		{"it's", "'it''s'"},
+		{"it’s", "'it’’s'"},
+		{"$HOME `n", "'$HOME `n'"},
+		{"", "''"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := DialectFor(PowerShell).Quote(tt.input)
+			if result != tt.expected {
+				t.Errorf("Quote(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTcshQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"simple", "'simple'"},
+		{"it's", `'it'\''s'`},
+		{"echo hi!", `'echo hi\!'`},
+		{"two\nlines", "'two\\\nlines'"},
+		{"", "''"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := DialectFor(Tcsh).Quote(tt.input)
+			if result != tt.expected {
+				t.Errorf("Quote(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNushellFinish(t *testing.T) {
+	d := DialectFor(Nushell)
+	code := strings.Join([]string{
+		d.UnsetVar("GREETING"),
+		d.UnsetVar("STALE"),
+		d.SetVar("GREETING", `say "hi"`),
+		d.DefineFunction("build", "make", "/project"),
+		d.DefineAlias("ll", "ls -la"),
+	}, "\n")
+
+	script, err := Finish(d, code)
+	if err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	var export nushellExport
+	if err := json.Unmarshal([]byte(script), &export); err != nil {
+		t.Fatalf("Expected a JSON document, got %q: %v", script, err)
+	}
+	// GREETING is unset first and set again later
+	if export.Set["GREETING"] != `say "hi"` || len(export.Unset) != 1 || export.Unset[0] != "STALE" {
+		t.Errorf("Unexpected export: %+v", export)
+	}
+	for _, want := range []string{
+		`def "build" [...args: string@"nu-complete direnv script"] { ^direnv run "build" ...$args }`,
+		`def "ll" [...args] { ^sh -c "ls -la \"$@\"" "ll" ...$args }`,
+	} {
+		if !strings.Contains(export.Defs, want) {
+			t.Errorf("Expected %q in defs, got: %s", want, export.Defs)
+		}
+	}
+
+	if script, _ := Finish(d, ""); script != `{"set":{},"unset":[],"defs":""}`+"\n" {
+		t.Errorf("Unexpected empty export: %s", script)
+	}
+	if script, _ := Finish(DialectFor(Bash), "export A='b'\n"); script != "export A='b'\n" {
+		t.Errorf("Expected bash code unchanged, got %q", script)
+	}
+}
+
+func TestDialectsRegistered(t *testing.T) {
+	for _, shellType := range []ShellType{Bash, Zsh, Fish, Nushell, PowerShell, Posix, Tcsh} {
+		d, ok := Lookup(shellType)
+		if !ok {
+			t.Errorf("No dialect for %s", shellType)
+			continue
+		}
+		if d.InitScript() == "" || d.CompletionScript() == "" {
+			t.Errorf("Missing init or completion script for %s", shellType)
+		}
+	}
+	if _, ok := Lookup(Unknown); ok {
+		t.Error("Expected no dialect for unknown shells")
+	}
+}
+
+// shellRunner evaluates generated code in a real shell.
+type shellRunner struct {
+	shellType ShellType
+	binary    string
+	args      []string // before the script file
+	// printVar is code printing $DIRENV_RT, or <unset> if it isn't set
+	printVar string
+	// script builds the script from the generated code; nil appends printVar
+	script func(t *testing.T, d Dialect, code string) string
+}
+
+var shellRunners = []shellRunner{
+	{shellType: Bash, binary: "bash", args: []string{"--norc", "--noprofile"}, printVar: `printf '%s' "${DIRENV_RT-<unset>}"`},
+	{shellType: Zsh, binary: "zsh", args: []string{"-f"}, printVar: `printf '%s' "${DIRENV_RT-<unset>}"`},
+	{shellType: Posix, binary: "sh", printVar: `printf '%s' "${DIRENV_RT-<unset>}"`},
+	{shellType: Fish, binary: "fish", args: []string{"--no-config"}, printVar: `if set -q DIRENV_RT; printf '%s' "$DIRENV_RT"; else; printf '<unset>'; end`},
+	{shellType: PowerShell, binary: "pwsh", args: []string{"-NoProfile", "-NonInteractive", "-File"}, printVar: `if (Test-Path Env:DIRENV_RT) { [Console]::Out.Write($env:DIRENV_RT) } else { [Console]::Out.Write('<unset>') }`},
+	{shellType: Tcsh, binary: "tcsh", args: []string{"-f"}, printVar: `if ( $?DIRENV_RT ) then
+    printenv DIRENV_RT | head -c -1
+else
+    printf '<unset>'
+endif`},
+	{shellType: Nushell, binary: "nu", args: []string{"--no-config-file"}, script: func(t *testing.T, d Dialect, code string) string {
+		export, err := Finish(d, code)
+		if err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+		path := filepath.Join(t.TempDir(), "export.json")
+		if err := os.WriteFile(path, []byte(export), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return `let export = (open --raw '` + path + `' | from json)
+hide-env --ignore-errors ...$export.unset
+load-env $export.set
+print --no-newline ($env.DIRENV_RT? | default "<unset>")
+`
+	}},
+}
+
+func (r shellRunner) run(t *testing.T, code string) string {
+	t.Helper()
+	d := DialectFor(r.shellType)
+	var script string
+	if r.script != nil {
+		script = r.script(t, d, code)
+	} else {
+		script = code + "\n" + r.printVar + "\n"
+	}
+
+	path := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := exec.Command(r.binary, append(r.args, path)...).Output()
+	if err != nil {
+		t.Fatalf("%s failed: %v\nscript:\n%s", r.binary, err, script)
+	}
+	return string(output)
+}
+
+func TestDialectRoundTrip(t *testing.T) {
+	values := []string{
+		"plain",
+		"it's",
+		`say "hi"`,
+		`back\slash`,
+		"dollar $HOME and $(id)",
+		"bang! !!",
+		"two\nlines",
+		"tab\there",
+		"glob * ? [a]",
+		"typographic ’quotes’",
+		"`backticks`",
+	}
+
+	for _, r := range shellRunners {
+		t.Run(string(r.shellType), func(t *testing.T) {
+			if _, err := exec.LookPath(r.binary); err != nil {
+				t.Skipf("%s not available", r.binary)
+			}
+			d := DialectFor(r.shellType)
+
+			for _, value := range values {
+				if got := r.run(t, d.SetVar("DIRENV_RT", value)); got != value {
+					t.Errorf("SetVar(%q) read back as %q", value, got)
+				}
+			}
+
+			code := d.SetVar("DIRENV_RT", "x") + "\n" + d.UnsetVar("DIRENV_RT")
+			if got := r.run(t, code); got != "<unset>" {
+				t.Errorf("Expected DIRENV_RT to be unset, got %q", got)
+			}
+		})
+	}
+}
+
+// TestBourneFunctions runs the aliases and functions of the dialects that
+// define them in shell code rather than through direnv run.
+func TestBourneFunctions(t *testing.T) {
+	for _, r := range shellRunners[:3] {
+		t.Run(string(r.shellType), func(t *testing.T) {
+			if _, err := exec.LookPath(r.binary); err != nil {
+				t.Skipf("%s not available", r.binary)
+			}
+			d := DialectFor(r.shellType)
+			root := t.TempDir()
+
+			code := strings.Join([]string{
+				d.DefineFunction("deploy-prod", `printf '%s|' "$PROJECT_ROOT" "$@"`, root),
+				d.DefineAlias("greet", "printf '<%s>'"),
+				// Aliases apply to lines read after they're defined, and
+				// bash expands them only when asked to
+				"[ -n \"$BASH_VERSION\" ] && shopt -s expand_aliases",
+				"eval 'deploy-prod a \"b c\"; greet x'",
+				d.RemoveFunction("deploy-prod"),
+				d.RemoveAlias("greet"),
+				"eval 'deploy-prod' 2>/dev/null || printf removed",
+			}, "\n")
+			want := root + "|a|b c|<x>removed"
+			if got := r.run(t, code); !strings.HasPrefix(got, want) {
+				t.Errorf("Expected %q, got %q", want, got)
+			}
+		})
+	}
+}
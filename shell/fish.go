@@ -0,0 +1,141 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+type fish struct{}
+
+// Quote quotes s for fish, where a backslash escapes a quote or another
+// backslash inside single quotes.
+func (fish) Quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+// SetVar sets variables whose name ends in PATH element by element: fish
+// treats them as lists, joined with colons when exported.
+func (f fish) SetVar(name, value string) string {
+	if !strings.HasSuffix(name, "PATH") || value == "" {
+		return fmt.Sprintf("set -gx %s %s", name, f.Quote(value))
+	}
+	elements := strings.Split(value, ":")
+	for i, element := range elements {
+		elements[i] = f.Quote(element)
+	}
+	return fmt.Sprintf("set -gx %s %s", name, strings.Join(elements, " "))
+}
+
+func (fish) UnsetVar(name string) string {
+	return fmt.Sprintf("set -e %s", name)
+}
+
+func (f fish) DefineAlias(name, command string) string {
+	return fmt.Sprintf("alias %s %s", name, f.Quote(command))
+}
+
+// RemoveAlias removes the function fish defines for an alias.
+func (f fish) RemoveAlias(name string) string {
+	return f.RemoveFunction(name)
+}
+
+// DefineFunction hands the script to direnv run, since fish can't run
+// POSIX shell code.
+func (f fish) DefineFunction(name, script, projectRoot string) string {
+	return fmt.Sprintf("function %s --description %s\n    direnv run %s $argv\nend\ncomplete -c %s -e\ncomplete -c %s -f -a %s", name, f.Quote("direnv script "+name), f.Quote(name), name, name, f.Quote("(__direnv_complete "+f.Quote(name)+")"))
+}
+
+func (fish) RemoveFunction(name string) string {
+	return fmt.Sprintf("functions -e %s\ncomplete -c %s -e", name, name)
+}
+
+func (fish) InitScript() string {
+	return fishInitScript
+}
+
+func (fish) CompletionScript() string {
+	return fishCompletionScript
+}
+
+const fishInitScript = `# direnv - Directory Environment Manager
+# Add this to your ~/.config/fish/config.fish
+
+set -gx DIRENV_SHELL fish
+# Identifies this shell to direnv, also from pipelines
+set -gx DIRENV_SHELL_PID $fish_pid
+
+function _direnv_check --on-variable PWD
+    # Prevent recursive calls
+    set -q _DIRENV_IN_PROGRESS; and return
+
+    set -gx _DIRENV_IN_PROGRESS 1
+    direnv export fish | source
+    set -e _DIRENV_IN_PROGRESS
+end
+
+function direnv-apply
+    direnv apply | source
+end
+
+function direnv-restore
+    direnv restore | source
+end
+
+function direnv-info
+    direnv info
+end
+
+function direnv-enable
+    direnv enable $argv
+end
+
+function direnv-disable
+    direnv disable $argv
+end
+
+# Initial check for current directory
+_direnv_check
+
+# Load completions if available
+if command -q direnv
+    direnv completion fish 2>/dev/null | source
+end
+`
+
+const fishCompletionScript = `# direnv fish completion
+# Candidates come from direnv __complete, which knows every command, flag
+# and script. ":files" asks for file names instead. Scripts exported as
+# functions pass their name to complete like direnv run <script>.
+function __direnv_complete
+    set -l words (commandline -opc)[2..-1]
+    if set -q argv[1]
+        set words run $argv[1] $words
+    end
+    for line in (direnv __complete --current=(commandline -ct) $words 2>/dev/null)
+        if test "$line" = :files
+            __fish_complete_path (commandline -ct)
+        else
+            echo $line
+        end
+    end
+end
+
+complete -c direnv -f -a '(__direnv_complete)'
+`
@@ -0,0 +1,225 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The shell integration is installed into a config file between these
+// markers, so it can be updated and removed without touching the rest.
+const (
+	BlockStart = "# >>> direnv >>>"
+	BlockEnd   = "# <<< direnv <<<"
+)
+
+// Block is an installed integration block.
+type Block struct {
+	// Version and Hash are recorded in the block's header: the direnv
+	// version that wrote it and the hash of the script it wrote.
+	Version string
+	Hash    string
+	// Modified is set if the script no longer matches Hash.
+	Modified bool
+}
+
+// ScriptHash identifies a script in a block header.
+func ScriptHash(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:6])
+}
+
+// FormatBlock returns script wrapped in the markers, with a header
+// recording version and the script's hash.
+func FormatBlock(script, version string) string {
+	if !strings.HasSuffix(script, "\n") {
+		script += "\n"
+	}
+	return fmt.Sprintf("%s\n# version: %s hash: %s\n%s%s\n", BlockStart, version, ScriptHash(script), script, BlockEnd)
+}
+
+// findBlock returns the byte range of the first block in content, from the
+// start of its first line to the end of its last, or -1, -1.
+func findBlock(content string) (int, int) {
+	start := strings.Index(content, BlockStart+"\n")
+	if start < 0 || (start > 0 && content[start-1] != '\n') {
+		return -1, -1
+	}
+	end := strings.Index(content[start:], "\n"+BlockEnd)
+	if end < 0 {
+		return -1, -1
+	}
+	end += start + len("\n"+BlockEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return start, end
+}
+
+// ParseBlock returns the first block in content, or nil if there is none.
+func ParseBlock(content string) *Block {
+	start, end := findBlock(content)
+	if start < 0 {
+		return nil
+	}
+	body := strings.TrimSuffix(content[start+len(BlockStart)+1:end], "\n")
+	body = strings.TrimSuffix(body, BlockEnd)
+
+	header, script, _ := strings.Cut(body, "\n")
+	var block Block
+	if _, err := fmt.Sscanf(header, "# version: %s hash: %s", &block.Version, &block.Hash); err != nil {
+		// A block without a header can't be checked, so it's outdated
+		return &Block{Modified: true}
+	}
+	block.Modified = ScriptHash(script) != block.Hash
+	return &block
+}
+
+// InstallBlock writes block into the file at path, replacing an existing
+// block in place or appending it. All other blocks are removed. Before the
+// file is changed, a copy is saved next to it; the copy's path is returned,
+// or "" if the file didn't exist or already held block.
+func InstallBlock(path, block string) (string, error) {
+	path, content, err := readConfigFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	updated := removeBlocks(content, block)
+	if updated == content && strings.Contains(content, block) {
+		return "", nil
+	}
+	if !strings.Contains(updated, block) {
+		if updated != "" && !strings.HasSuffix(updated, "\n") {
+			updated += "\n"
+		}
+		if updated != "" {
+			updated += "\n"
+		}
+		updated += block
+	}
+	return writeConfigFile(path, content, updated)
+}
+
+// UninstallBlock removes all blocks from the file at path. It returns the
+// path of the backup, or "" if there was no block to remove.
+func UninstallBlock(path string) (string, error) {
+	path, content, err := readConfigFile(path)
+	if err != nil {
+		return "", err
+	}
+	updated := WithoutBlocks(content)
+	if updated == content {
+		return "", nil
+	}
+	return writeConfigFile(path, content, updated)
+}
+
+// WithoutBlocks returns content with all blocks removed.
+func WithoutBlocks(content string) string {
+	return removeBlocks(content, "")
+}
+
+// removeBlocks replaces the first block in content with replacement and
+// removes the others.
+func removeBlocks(content, replacement string) string {
+	var out strings.Builder
+	for {
+		start, end := findBlock(content)
+		if start < 0 {
+			out.WriteString(content)
+			return out.String()
+		}
+		prefix := content[:start]
+		if replacement == "" && strings.HasSuffix(prefix, "\n\n") {
+			// Drop the blank line InstallBlock put before the block
+			prefix = prefix[:len(prefix)-1]
+		}
+		out.WriteString(prefix)
+		out.WriteString(replacement)
+		replacement = ""
+		content = content[end:]
+	}
+}
+
+// readConfigFile returns the path with symlinks resolved, so a config
+// managed in a dotfiles repository is updated rather than replaced, and
+// its content. A missing file reads as empty.
+func readConfigFile(path string) (string, string, error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return path, string(data), nil
+}
+
+// writeConfigFile saves a backup of the file at path if it exists and
+// atomically replaces it with updated.
+func writeConfigFile(path, content, updated string) (string, error) {
+	mode := os.FileMode(0644)
+	backup := ""
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		backup = backupPath(path)
+		if err := os.WriteFile(backup, []byte(content), mode); err != nil {
+			return "", fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	} else if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(updated); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return backup, nil
+}
+
+// backupPath returns a path for a new backup of the file at path. The first
+// backup, <path>.direnv-backup, holds the file from before direnv was
+// installed and is never replaced; later ones are numbered.
+func backupPath(path string) string {
+	backup := path + ".direnv-backup"
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(backup); err != nil {
+			return backup
+		}
+		backup = fmt.Sprintf("%s.direnv-backup.%d", path, n)
+	}
+}
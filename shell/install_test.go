@@ -0,0 +1,144 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstallBlock(t *testing.T) {
+	dir := t.TempDir()
+	rcFile := filepath.Join(dir, ".bashrc")
+	original := "alias ll='ls -l'\n"
+	if err := os.WriteFile(rcFile, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	first := FormatBlock("echo one", "v1.0.0")
+	backup, err := InstallBlock(rcFile, first)
+	if err != nil {
+		t.Fatalf("InstallBlock failed: %v", err)
+	}
+	if data, _ := os.ReadFile(backup); string(data) != original {
+		t.Errorf("Expected backup of the original file, got %q", data)
+	}
+	if data, _ := os.ReadFile(rcFile); string(data) != original+"\n"+first {
+		t.Errorf("Unexpected file after install:\n%s", data)
+	}
+	if info, _ := os.Stat(rcFile); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600 to be kept, got %v", info.Mode().Perm())
+	}
+
+	// Installing the same block again changes nothing
+	if backup, err := InstallBlock(rcFile, first); err != nil || backup != "" {
+		t.Errorf("Expected no change, got backup %q, error %v", backup, err)
+	}
+
+	// A new block replaces the old one in place
+	if err := os.WriteFile(rcFile, []byte(original+"\n"+first+"export AFTER=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	second := FormatBlock("echo two", "v1.1.0")
+	backup, err = InstallBlock(rcFile, second)
+	if err != nil {
+		t.Fatalf("InstallBlock failed: %v", err)
+	}
+	if filepath.Base(backup) != ".bashrc.direnv-backup.1" {
+		t.Errorf("Expected a numbered backup, got %s", backup)
+	}
+	// The first backup still holds the file from before the install
+	if data, _ := os.ReadFile(rcFile + ".direnv-backup"); string(data) != original {
+		t.Errorf("Expected the original backup to be kept, got %q", data)
+	}
+	if data, _ := os.ReadFile(rcFile); string(data) != original+"\n"+second+"export AFTER=1\n" {
+		t.Errorf("Expected the block to be replaced in place, got:\n%s", data)
+	}
+
+	if _, err := UninstallBlock(rcFile); err != nil {
+		t.Fatalf("UninstallBlock failed: %v", err)
+	}
+	if data, _ := os.ReadFile(rcFile); string(data) != original+"export AFTER=1\n" {
+		t.Errorf("Unexpected file after uninstall:\n%s", data)
+	}
+	if backup, err := UninstallBlock(rcFile); err != nil || backup != "" {
+		t.Errorf("Expected nothing to uninstall, got backup %q, error %v", backup, err)
+	}
+}
+
+func TestInstallBlockNewFile(t *testing.T) {
+	rcFile := filepath.Join(t.TempDir(), "fish", "config.fish")
+	block := FormatBlock("echo one\n", "v1.0.0")
+	backup, err := InstallBlock(rcFile, block)
+	if err != nil {
+		t.Fatalf("InstallBlock failed: %v", err)
+	}
+	if backup != "" {
+		t.Errorf("Expected no backup of a new file, got %s", backup)
+	}
+	if data, _ := os.ReadFile(rcFile); string(data) != block {
+		t.Errorf("Unexpected file:\n%s", data)
+	}
+}
+
+func TestInstallBlockFollowsSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "bashrc")
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("# mine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, ".bashrc")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	if _, err := InstallBlock(link, FormatBlock("echo one", "v1.0.0")); err != nil {
+		t.Fatalf("InstallBlock failed: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected the symlink to be kept")
+	}
+	if data, _ := os.ReadFile(target); !strings.Contains(string(data), BlockStart) {
+		t.Errorf("Expected the block in the link target, got:\n%s", data)
+	}
+}
+
+func TestParseBlock(t *testing.T) {
+	if block := ParseBlock("alias ll=ls\n"); block != nil {
+		t.Errorf("Expected no block, got %+v", block)
+	}
+
+	block := FormatBlock("echo one", "v1.0.0")
+	parsed := ParseBlock("# before\n" + block + "# after\n")
+	if parsed == nil || parsed.Version != "v1.0.0" || parsed.Hash != ScriptHash("echo one\n") || parsed.Modified {
+		t.Errorf("Unexpected block: %+v", parsed)
+	}
+
+	edited := strings.Replace(block, "echo one", "echo edited", 1)
+	if parsed := ParseBlock(edited); parsed == nil || !parsed.Modified {
+		t.Errorf("Expected an edited block to be reported, got %+v", parsed)
+	}
+
+	if parsed := ParseBlock(BlockStart + "\necho old\n" + BlockEnd + "\n"); parsed == nil || !parsed.Modified {
+		t.Errorf("Expected a block without header to be reported, got %+v", parsed)
+	}
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/TierOne-Software/direnv/config"
+)
+
+// Nushell can't evaluate shell code, so its export is a JSON document that
+// its hook applies with load-env and hide-env:
+//
+//	{"set": {"NAME": "value"}, "unset": ["OLD"], "defs": "def build [...args] { ... }"}
+//
+// defs is nushell source defining the project's aliases and scripts. The
+// dialect emits one nushellOp per line, which Finish folds into that
+// document.
+type nushell struct{}
+
+type nushellOp struct {
+	Set   map[string]string `json:"set,omitempty"`
+	Unset []string          `json:"unset,omitempty"`
+	Def   string            `json:"def,omitempty"`
+}
+
+// nushellExport is the document the nu hook consumes.
+type nushellExport struct {
+	Set   map[string]string `json:"set"`
+	Unset []string          `json:"unset"`
+	Defs  string            `json:"defs"`
+}
+
+func nushellLine(op nushellOp) string {
+	data, err := json.Marshal(op)
+	if err != nil {
+		// Marshalling maps of strings can't fail
+		panic(err)
+	}
+	return string(data)
+}
+
+// Quote quotes s as a nushell double-quoted string.
+func (nushell) Quote(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+func (nushell) SetVar(name, value string) string {
+	return nushellLine(nushellOp{Set: map[string]string{name: value}})
+}
+
+func (nushell) UnsetVar(name string) string {
+	return nushellLine(nushellOp{Unset: []string{name}})
+}
+
+// DefineAlias defines a command that runs the alias with sh, appending its
+// arguments as a POSIX alias would.
+func (n nushell) DefineAlias(name, command string) string {
+	return nushellLine(nushellOp{Def: fmt.Sprintf("def %s [...args] { ^sh -c %s %s ...$args }", n.Quote(name), n.Quote(command+` "$@"`), n.Quote(name))})
+}
+
+// RemoveAlias returns "": nushell can't remove commands at runtime, and the
+// ones it keeps stop working once the project is left.
+func (nushell) RemoveAlias(name string) string {
+	return ""
+}
+
+// DefineFunction defines a command handing its arguments to direnv run,
+// since scripts are POSIX shell code.
+func (n nushell) DefineFunction(name, script, projectRoot string) string {
+	return nushellLine(nushellOp{Def: fmt.Sprintf("def %s [...args: string@\"nu-complete direnv script\"] { ^direnv run %s ...$args }", n.Quote(name), n.Quote(name))})
+}
+
+// RemoveFunction returns "": the scripts nushell keeps defined only call
+// direnv run, which fails outside the project.
+func (nushell) RemoveFunction(name string) string {
+	return ""
+}
+
+// Finish folds the lines into one export document. Later operations win
+// over earlier ones on the same variable.
+func (nushell) Finish(code string) (string, error) {
+	set := make(map[string]string)
+	unset := make(map[string]bool)
+	var defs []string
+	for _, line := range strings.Split(code, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var op nushellOp
+		if err := json.Unmarshal([]byte(line), &op); err != nil {
+			return "", fmt.Errorf("invalid nushell export line %q: %w", line, err)
+		}
+		for key, value := range op.Set {
+			set[key] = value
+			delete(unset, key)
+		}
+		for _, key := range op.Unset {
+			unset[key] = true
+			delete(set, key)
+		}
+		if op.Def != "" {
+			defs = append(defs, op.Def)
+		}
+	}
+
+	export := nushellExport{Set: set, Unset: make([]string, 0, len(unset))}
+	for key := range unset {
+		export.Unset = append(export.Unset, key)
+	}
+	sort.Strings(export.Unset)
+	sort.Strings(defs)
+	if len(defs) > 0 {
+		export.Defs = strings.Join(defs, "\n") + "\n"
+	}
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal nushell export: %w", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// InitScript includes the completions, as nushell can't evaluate the
+// output of direnv completion.
+func (nushell) InitScript() string {
+	return fmt.Sprintf(nushellInitScript, NushellDefsDir()) + "\n" + nushellCompletionScript
+}
+
+func (nushell) CompletionScript() string {
+	return nushellCompletionScript
+}
+
+// NushellDefsDir holds a defs_<pid>.nu file per nu shell, where its hook
+// saves the commands of the applied project.
+func NushellDefsDir() string {
+	dir, err := config.Dir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "direnv-nushell")
+	}
+	return filepath.Join(dir, "nushell")
+}
+
+const nushellInitScript = `# direnv - Directory Environment Manager
+# Save this next to your config.nu and source it from there:
+#   direnv init nu | save -f ($nu.default-config-dir | path join direnv.nu)
+#   "source direnv.nu\n" | save -a $nu.config-path
+
+$env.DIRENV_SHELL = "nu"
+# Identifies this shell to direnv
+$env.DIRENV_SHELL_PID = ($nu.pid | into string)
+
+# Commands for the project's aliases and scripts, rewritten by every apply.
+# Each shell has its own file, so shells in different projects don't
+# overwrite each other's.
+const _direnv_defs = ('%s' | path join $"defs_($nu.pid).nu")
+mkdir ($_direnv_defs | path dirname)
+"" | save --force $_direnv_defs
+
+# Run direnv apply, restore or export and load the JSON export it prints
+def --env _direnv_export [...args: string] {
+    let result = (^direnv ...$args | complete)
+    if $result.stderr != "" {
+        print --stderr --no-newline $result.stderr
+    }
+    if $result.exit_code != 0 {
+        return
+    }
+
+    let export = ($result.stdout | from json)
+    hide-env --ignore-errors ...$export.unset
+    mut set = $export.set
+    if "PATH" in ($set | columns) {
+        $set.PATH = ($set.PATH | split row (char esep))
+    }
+    load-env $set
+    $export.defs | save --force $_direnv_defs
+}
+
+def --env _direnv_check [] {
+    _direnv_export export nu
+}
+
+def --env direnv-apply [] {
+    _direnv_export apply
+}
+
+def --env direnv-restore [] {
+    _direnv_export restore
+}
+
+def direnv-info [] {
+    ^direnv info
+}
+
+def direnv-enable [...args: string] {
+    ^direnv enable ...$args
+}
+
+def direnv-disable [...args: string] {
+    ^direnv disable ...$args
+}
+
+# Check on every directory change
+$env.config = ($env.config | upsert hooks.env_change.PWD {|config|
+    ($config.hooks?.env_change?.PWD? | default []) | append {|before, after| _direnv_check }
+})
+
+# Commands can only be defined by a hook given as source code. It loads the
+# defs before every prompt, so the first prompt has those of the initial
+# check and every apply is picked up, with or without a directory change.
+$env.config = ($env.config | upsert hooks.pre_prompt {|config|
+    ($config.hooks?.pre_prompt? | default []) | append {code: $"source '($_direnv_defs)'"}
+})
+
+# Initial check for current directory
+_direnv_check
+`
+
+const nushellCompletionScript = `# direnv nushell completion
+# Candidates come from direnv __complete, which knows every command, flag
+# and script. ":files" asks for file names, which nushell completes when
+# a completer returns null.
+def _direnv_candidates [words: list<string>] {
+    let current = ($words | last)
+    let before = ($words | drop 1)
+    let lines = (^direnv __complete $"--current=($current)" ...$before | complete | get stdout | lines)
+    if ":files" in $lines {
+        return null
+    }
+    $lines | each {|line|
+        let parts = ($line | split row "\t")
+        {value: ($parts | first), description: ($parts | skip 1 | str join "\t")}
+    }
+}
+
+def "nu-complete direnv" [context: string] {
+    _direnv_candidates ($context | split row --regex '\s+' | skip 1)
+}
+
+# Completes a script exported as a command like direnv run <script>
+def "nu-complete direnv script" [context: string] {
+    _direnv_candidates (["run"] | append ($context | split row --regex '\s+'))
+}
+
+extern "direnv" [
+    ...args: string@"nu-complete direnv"
+]
+`
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import "fmt"
+
+// posix is strict POSIX sh, for sh, dash, busybox and the Korn shells: no
+// local, no [[ ]] and no hyphens in function names.
+type posix struct{ bourne }
+
+func (p posix) DefineFunction(name, script, projectRoot string) string {
+	// No local in POSIX sh; the subshell scopes PROJECT_ROOT instead
+	fn := posixFunctionName(name)
+	def := fmt.Sprintf("%s() {\n    (\n        PROJECT_ROOT=%s\n        cd \"$PROJECT_ROOT\" || exit\n%s\n    )\n}", fn, p.Quote(projectRoot), indent(script, "        "))
+	if fn != name {
+		def += fmt.Sprintf("\nalias %s=%s", name, fn)
+	}
+	return def
+}
+
+func (posix) RemoveFunction(name string) string {
+	if fn := posixFunctionName(name); fn != name {
+		return fmt.Sprintf("unset -f %s\nunalias %s 2>/dev/null", fn, name)
+	}
+	return fmt.Sprintf("unset -f %s", name)
+}
+
+func (posix) InitScript() string {
+	return posixInitScript
+}
+
+func (posix) CompletionScript() string {
+	return "# POSIX sh has no programmable completion\n"
+}
+
+// posixFunctionName returns a valid POSIX function name for a script.
+// Names such as deploy-prod aren't, so they get a mangled function that an
+// alias of the original name calls.
+func posixFunctionName(name string) string {
+	valid := name != "" && !(name[0] >= '0' && name[0] <= '9')
+	mangled := []byte(name)
+	for i, c := range mangled {
+		if !isNameChar(c) {
+			mangled[i] = '_'
+			valid = false
+		}
+	}
+	if valid {
+		return name
+	}
+	return "_direnv_script_" + string(mangled)
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+const posixInitScript = `# direnv - Directory Environment Manager
+# Add this to the file named by $ENV (e.g. ~/.shrc), and set ENV in your
+# ~/.profile so interactive shells read it:
+#   ENV=$HOME/.shrc; export ENV
+
+DIRENV_SHELL=sh
+export DIRENV_SHELL
+# Identifies this shell to direnv, also from subshells and pipelines
+DIRENV_SHELL_PID=$$
+export DIRENV_SHELL_PID
+
+_direnv_check() {
+    # Prevent recursive calls
+    if [ "${_DIRENV_IN_PROGRESS:-}" = 1 ]; then
+        return 0
+    fi
+
+    _DIRENV_IN_PROGRESS=1
+    eval "$(direnv export sh)"
+    unset _DIRENV_IN_PROGRESS
+}
+
+_direnv_cd() {
+    command cd "$@" && _direnv_check
+}
+
+# Function names can't contain hyphens in POSIX sh, aliases can
+_direnv_apply() {
+    eval "$(direnv apply)"
+}
+
+_direnv_restore() {
+    eval "$(direnv restore)"
+}
+
+_direnv_enable() {
+    direnv enable "$@"
+}
+
+_direnv_disable() {
+    direnv disable "$@"
+}
+
+alias direnv-apply=_direnv_apply
+alias direnv-restore=_direnv_restore
+alias direnv-info='direnv info'
+alias direnv-enable=_direnv_enable
+alias direnv-disable=_direnv_disable
+
+# Override cd
+alias cd=_direnv_cd
+
+# Initial check for current directory
+_direnv_check
+`
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+type powershell struct{}
+
+// Quote quotes s for PowerShell. It treats typographic single quotes like
+// ASCII ones, so those are doubled too.
+func (powershell) Quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'', '‘', '’', '‚', '‛':
+			b.WriteRune(r)
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+func (p powershell) SetVar(name, value string) string {
+	return fmt.Sprintf("$env:%s = %s", name, p.Quote(value))
+}
+
+func (powershell) UnsetVar(name string) string {
+	return fmt.Sprintf("Remove-Item Env:%s -ErrorAction SilentlyContinue", name)
+}
+
+// DefineAlias defines a function running the command with sh, as
+// PowerShell aliases can't take arguments.
+func (p powershell) DefineAlias(name, command string) string {
+	return fmt.Sprintf("function global:%s {\n    & sh -c %s %s @args\n}", name, p.Quote(command+` "$@"`), p.Quote(name))
+}
+
+func (p powershell) RemoveAlias(name string) string {
+	return p.RemoveFunction(name)
+}
+
+func (p powershell) DefineFunction(name, script, projectRoot string) string {
+	// Scripts complete like direnv run <script>
+	return fmt.Sprintf("function global:%s {\n    & direnv run %s @args\n}\nRegister-ArgumentCompleter -Native -CommandName %s -ScriptBlock {\n    param($wordToComplete, $commandAst, $cursorPosition)\n    _direnv_candidates $commandAst $wordToComplete @('run', %s)\n}", name, p.Quote(name), p.Quote(name), p.Quote(name))
+}
+
+func (powershell) RemoveFunction(name string) string {
+	return fmt.Sprintf("Remove-Item Function:%s -ErrorAction SilentlyContinue", name)
+}
+
+func (powershell) InitScript() string {
+	return powershellInitScript
+}
+
+func (powershell) CompletionScript() string {
+	return powershellCompletionScript
+}
+
+const powershellInitScript = `# direnv - Directory Environment Manager
+# Add this to your PowerShell profile ($PROFILE)
+
+$env:DIRENV_SHELL = 'pwsh'
+# Identifies this shell to direnv
+$env:DIRENV_SHELL_PID = "$PID"
+
+function global:_direnv_check {
+    # Prevent recursive calls
+    if ($env:_DIRENV_IN_PROGRESS -eq '1') { return }
+
+    $env:_DIRENV_IN_PROGRESS = '1'
+    try {
+        direnv export pwsh | Out-String | Invoke-Expression
+    } finally {
+        Remove-Item Env:_DIRENV_IN_PROGRESS -ErrorAction SilentlyContinue
+    }
+}
+
+function global:direnv-apply {
+    direnv apply | Out-String | Invoke-Expression
+}
+
+function global:direnv-restore {
+    direnv restore | Out-String | Invoke-Expression
+}
+
+function global:direnv-info {
+    direnv info
+}
+
+function global:direnv-enable {
+    direnv enable @args
+}
+
+function global:direnv-disable {
+    direnv disable @args
+}
+
+# Check whenever the prompt shows a new location, which covers Set-Location,
+# Push-Location and Pop-Location
+$global:_direnv_last_location = $null
+$global:_direnv_prompt = $function:prompt
+function global:prompt {
+    $location = (Get-Location).Path
+    if ($location -ne $global:_direnv_last_location) {
+        $global:_direnv_last_location = $location
+        _direnv_check
+    }
+    & $global:_direnv_prompt
+}
+
+# Load completions if available
+if (Get-Command direnv -CommandType Application -ErrorAction SilentlyContinue) {
+    direnv completion pwsh 2>$null | Out-String | Invoke-Expression
+}
+`
+
+const powershellCompletionScript = `# direnv PowerShell completion
+# Candidates come from direnv __complete, which knows every command, flag
+# and script. ":files" asks for file names, which PowerShell completes when
+# a completer returns nothing.
+function global:_direnv_candidates($commandAst, $wordToComplete, $prefix) {
+    # Words before the one being completed, without the command itself
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -ne '' -and $words.Count -gt 0) {
+        $words = @($words | Select-Object -First ($words.Count - 1))
+    }
+
+    $lines = @(direnv __complete "--current=$wordToComplete" @prefix @words 2>$null)
+    if ($lines -contains ':files') { return }
+    foreach ($line in $lines) {
+        $word, $description = $line -split "` + "`" + `t", 2
+        if (-not $description) { $description = $word }
+        [System.Management.Automation.CompletionResult]::new($word, $word, 'ParameterValue', $description)
+    }
+}
+
+Register-ArgumentCompleter -Native -CommandName direnv -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    _direnv_candidates $commandAst $wordToComplete @()
+}
+`
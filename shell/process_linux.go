@@ -0,0 +1,59 @@
+//go:build linux
+
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// processInfo returns the executable of process pid, its command name and
+// its parent's PID, from /proc.
+func processInfo(pid int) (string, string, int, error) {
+	dir := fmt.Sprintf("/proc/%d", pid)
+
+	// exe can't be read for processes of other users; comm still names them
+	exe, _ := os.Readlink(dir + "/exe")
+	comm, err := os.ReadFile(dir + "/comm")
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	// The parent PID is the second field after the command, which is in
+	// parentheses and may itself contain spaces and parentheses
+	stat, err := os.ReadFile(dir + "/stat")
+	if err != nil {
+		return "", "", 0, err
+	}
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return "", "", 0, fmt.Errorf("unexpected format of %s/stat", dir)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 2 {
+		return "", "", 0, fmt.Errorf("unexpected format of %s/stat", dir)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return "", "", 0, fmt.Errorf("unexpected format of %s/stat: %w", dir, err)
+	}
+	return exe, strings.TrimSpace(string(comm)), ppid, nil
+}
@@ -0,0 +1,46 @@
+//go:build !linux && !windows
+
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// processInfo returns the executable of process pid, its command name and
+// its parent's PID. Without /proc, ps reports them; its comm is the
+// executable path on macOS and the BSDs.
+func processInfo(pid int) (string, string, int, error) {
+	output, err := exec.Command("ps", "-o", "ppid=,comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", "", 0, err
+	}
+	ppidField, comm, ok := strings.Cut(strings.TrimSpace(string(output)), " ")
+	if !ok {
+		return "", "", 0, fmt.Errorf("unexpected output of ps: %q", output)
+	}
+	ppid, err := strconv.Atoi(ppidField)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("unexpected output of ps: %q", output)
+	}
+	comm = strings.TrimSpace(comm)
+	return comm, comm, ppid, nil
+}
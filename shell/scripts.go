@@ -16,157 +16,32 @@
 
 package shell
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 func GetInitScript(shellType ShellType) string {
-	switch shellType {
-	case Bash:
-		return bashInitScript
-	case Zsh:
-		return zshInitScript
-	default:
+	d, ok := Lookup(shellType)
+	if !ok {
 		return fmt.Sprintf("# Shell type '%s' is not yet supported\n", shellType)
 	}
+	return d.InitScript()
 }
 
-const bashInitScript = `# direnv - Directory Environment Manager
-# Add this to your ~/.bashrc
-
-export DIRENV_SHELL=bash
-
-_direnv_check() {
-    # Prevent recursive calls
-    [[ "${_DIRENV_IN_PROGRESS:-}" == "1" ]] && return
-
-    if [[ "${DIRENV_AUTO_APPLY:-}" =~ ^1$ ]]; then
-        if [[ -f ".direnv.toml" ]]; then
-            export _DIRENV_IN_PROGRESS=1
-            eval "$(direnv apply 2>/dev/null)"
-            unset _DIRENV_IN_PROGRESS
-        fi
-    fi
-}
-
-_direnv_cd() {
-    builtin cd "$@" && _direnv_check
-}
-
-_direnv_pushd() {
-    builtin pushd "$@" && _direnv_check
-}
-
-_direnv_popd() {
-    builtin popd "$@" && _direnv_check
-}
-
-direnv-apply() {
-    eval "$(direnv apply)"
-}
-
-direnv-restore() {
-    direnv restore
-}
-
-direnv-info() {
-    direnv info
-}
-
-direnv-enable() {
-    direnv enable
-    echo "Auto-apply enabled"
-}
-
-direnv-disable() {
-    direnv disable
-    echo "Auto-apply disabled"
-}
-
-# Override cd, pushd, popd
-alias cd='_direnv_cd'
-alias pushd='_direnv_pushd'
-alias popd='_direnv_popd'
-
-# Initial check for current directory
-_direnv_check
-
-# Load completions if available
-if command -v direnv >/dev/null 2>&1; then
-    eval "$(direnv completion bash 2>/dev/null)"
-fi
-`
-
-const zshInitScript = `# direnv - Directory Environment Manager
-# Add this to your ~/.zshrc
-
-export DIRENV_SHELL=zsh
-
-_direnv_check() {
-    # Prevent recursive calls
-    [[ "${_DIRENV_IN_PROGRESS:-}" == "1" ]] && return
-
-    if [[ "${DIRENV_AUTO_APPLY:-}" =~ ^1$ ]]; then
-        if [[ -f ".direnv.toml" ]]; then
-            export _DIRENV_IN_PROGRESS=1
-            eval "$(direnv apply 2>/dev/null)"
-            unset _DIRENV_IN_PROGRESS
-        fi
-    fi
-}
-
-# Use zsh's native chpwd hook
-autoload -U add-zsh-hook
-add-zsh-hook chpwd _direnv_check
-
-direnv-apply() {
-    eval "$(direnv apply)"
-}
-
-direnv-restore() {
-    direnv restore
-}
-
-direnv-info() {
-    direnv info
-}
-
-direnv-enable() {
-    direnv enable
-    echo "Auto-apply enabled"
-}
-
-direnv-disable() {
-    direnv disable
-    echo "Auto-apply disabled"
-}
-
-# For manual directory changes that might not trigger chpwd
-_direnv_cd() {
-    builtin cd "$@" && _direnv_check
-}
-
-_direnv_pushd() {
-    builtin pushd "$@" && _direnv_check
-}
-
-_direnv_popd() {
-    builtin popd "$@" && _direnv_check
+// GetHookScript returns the init script with the completion included in
+// place of the code that loads it, so one eval sets up both.
+func GetHookScript(shellType ShellType) (string, error) {
+	d, ok := Lookup(shellType)
+	if !ok {
+		return "", UnsupportedError(shellType)
+	}
+	init, completion := d.InitScript(), d.CompletionScript()
+	if strings.Contains(init, completion) {
+		return init, nil
+	}
+	if i := strings.LastIndex(init, completionLoader); i >= 0 {
+		init = init[:i+1]
+	}
+	return init + "\n" + completion, nil
 }
-
-# Optional aliases (zsh's chpwd hook should handle most cases)
-alias cd='_direnv_cd'
-alias pushd='_direnv_pushd'
-alias popd='_direnv_popd'
-
-# Initial check for current directory
-_direnv_check
-
-# Load completions if available
-if command -v direnv >/dev/null 2>&1; then
-    eval "$(direnv hook zsh 2>/dev/null)"
-fi
-
-# Apply cd completions to direnv aliases
-compdef _cd _direnv_cd
-compdef _cd _direnv_pushd
-compdef _cd _direnv_popd
-`
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestZshInitScript(t *testing.T) {
+	init := GetInitScript(Zsh)
+	if !strings.Contains(init, "precmd_functions=(_direnv_hook $precmd_functions)") {
+		t.Errorf("Expected the zsh init script to hook precmd:\n%s", init)
+	}
+	// A chpwd hook would run direnv export a second time for every cd
+	if strings.Contains(init, "chpwd") {
+		t.Errorf("Expected the zsh init script not to hook chpwd:\n%s", init)
+	}
+}
+
+func TestFishScripts(t *testing.T) {
+	init := GetInitScript(Fish)
+	for _, want := range []string{
+		"function _direnv_check --on-variable PWD",
+		"direnv apply | source",
+		"direnv completion fish 2>/dev/null | source",
+	} {
+		if !strings.Contains(init, want) {
+			t.Errorf("Expected %q in fish init script", want)
+		}
+	}
+
+	completion := GetCompletionScript(Fish)
+	for _, want := range []string{
+		"function __direnv_complete",
+		"direnv __complete --current=(commandline -ct) $words",
+		"complete -c direnv -f -a '(__direnv_complete)'",
+	} {
+		if !strings.Contains(completion, want) {
+			t.Errorf("Expected %q in fish completion script", want)
+		}
+	}
+}
+
+func TestNushellScripts(t *testing.T) {
+	init := GetInitScript(Nushell)
+	for _, want := range []string{
+		"$env.DIRENV_SHELL = \"nu\"",
+		"upsert hooks.env_change.PWD",
+		"load-env $set",
+		"hide-env --ignore-errors ...$export.unset",
+		"const _direnv_defs = ('" + NushellDefsDir() + "' | path join $\"defs_($nu.pid).nu\")",
+		"upsert hooks.pre_prompt",
+		"{code: $\"source '($_direnv_defs)'\"}",
+		// completions are part of the init script
+		"extern \"direnv\" [",
+		"def \"nu-complete direnv script\" [context: string]",
+	} {
+		if !strings.Contains(init, want) {
+			t.Errorf("Expected %q in nushell init script", want)
+		}
+	}
+	if strings.Contains(init, "%!") {
+		t.Errorf("Init script has formatting errors:\n%s", init)
+	}
+}
+
+func TestPowerShellScripts(t *testing.T) {
+	init := GetInitScript(PowerShell)
+	for _, want := range []string{
+		"$env:DIRENV_SHELL = 'pwsh'",
+		"direnv apply | Out-String | Invoke-Expression",
+		"function global:prompt {",
+		"direnv completion pwsh",
+	} {
+		if !strings.Contains(init, want) {
+			t.Errorf("Expected %q in PowerShell init script", want)
+		}
+	}
+
+	completion := GetCompletionScript(PowerShell)
+	for _, want := range []string{
+		"Register-ArgumentCompleter -Native -CommandName direnv",
+		"direnv __complete \"--current=$wordToComplete\" @prefix @words",
+	} {
+		if !strings.Contains(completion, want) {
+			t.Errorf("Expected %q in PowerShell completion script", want)
+		}
+	}
+}
+
+func TestPosixInitScript(t *testing.T) {
+	init := GetInitScript(Posix)
+	for _, bashism := range []string{"[[", "local ", "=~", "pushd", "function "} {
+		if strings.Contains(init, bashism) {
+			t.Errorf("Expected no %q in POSIX init script", bashism)
+		}
+	}
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	path := filepath.Join(t.TempDir(), "init.sh")
+	if err := os.WriteFile(path, []byte(init), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := exec.Command(sh, "-n", path).CombinedOutput(); err != nil {
+		t.Errorf("sh -n rejected the init script: %v\n%s", err, output)
+	}
+}
+
+func TestTcshScripts(t *testing.T) {
+	init := GetInitScript(Tcsh)
+	for _, want := range []string{
+		"setenv DIRENV_SHELL tcsh",
+		"alias cwdcmd _direnv_check",
+		"alias cwdcmd '_direnv_cwdcmd; _direnv_check'",
+		"direnv \\!* >! $_direnv_tmp && source $_direnv_tmp",
+		"_direnv_source completion tcsh",
+	} {
+		if !strings.Contains(init, want) {
+			t.Errorf("Expected %q in tcsh init script", want)
+		}
+	}
+
+	completion := GetCompletionScript(Tcsh)
+	if !strings.Contains(completion, "'p/*/`direnv __complete --line`/'") {
+		t.Errorf("Expected script completion in tcsh completion script:\n%s", completion)
+	}
+}
+
+func TestGetHookScript(t *testing.T) {
+	for shellType, d := range dialects {
+		script, err := GetHookScript(shellType)
+		if err != nil {
+			t.Errorf("GetHookScript(%s) failed: %v", shellType, err)
+			continue
+		}
+		if strings.Contains(script, completionLoader) {
+			t.Errorf("Expected %s hook script to include the completion instead of loading it", shellType)
+		}
+		if !strings.Contains(script, d.CompletionScript()) || !strings.HasPrefix(script, "# direnv") {
+			t.Errorf("Expected %s hook script to hold init and completion, got:\n%s", shellType, script)
+		}
+	}
+
+	if _, err := GetHookScript(ShellType("elvish")); err == nil {
+		t.Error("Expected an error for an unsupported shell")
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tcsh is the dialect of tcsh and csh.
+type tcsh struct{}
+
+// Quote quotes s for csh. History substitution happens even inside single
+// quotes, so ! is escaped, and a newline needs a backslash to stay inside
+// the quotes.
+func (tcsh) Quote(s string) string {
+	replacer := strings.NewReplacer("'", `'\''`, "!", `\!`, "\n", "\\\n")
+	return "'" + replacer.Replace(s) + "'"
+}
+
+func (t tcsh) SetVar(name, value string) string {
+	return fmt.Sprintf("setenv %s %s", name, t.Quote(value))
+}
+
+func (tcsh) UnsetVar(name string) string {
+	return fmt.Sprintf("unsetenv %s", name)
+}
+
+func (t tcsh) DefineAlias(name, command string) string {
+	return fmt.Sprintf("alias %s %s", name, t.Quote(command))
+}
+
+func (tcsh) RemoveAlias(name string) string {
+	return fmt.Sprintf("unalias %s", name)
+}
+
+// DefineFunction defines an alias, as csh has no functions. It passes its
+// arguments on with \!*.
+func (tcsh) DefineFunction(name, script, projectRoot string) string {
+	// Scripts complete like direnv run <script>
+	return fmt.Sprintf("alias %s 'direnv run %s \\!*'\ncomplete %s 'p/*/`direnv __complete --line run %s`/'", name, name, name, name)
+}
+
+func (t tcsh) RemoveFunction(name string) string {
+	return t.RemoveAlias(name) + fmt.Sprintf("\nuncomplete %s", name)
+}
+
+func (tcsh) InitScript() string {
+	return tcshInitScript
+}
+
+func (tcsh) CompletionScript() string {
+	return tcshCompletionScript
+}
+
+const tcshInitScript = `# direnv - Directory Environment Manager
+# Add this to your ~/.tcshrc
+
+setenv DIRENV_SHELL tcsh
+# Identifies this shell to direnv, also from pipelines
+setenv DIRENV_SHELL_PID $$
+
+# csh can't eval multi-line output reliably, so the output is sourced
+alias _direnv_source 'set _direnv_tmp = ` + "`" + `mktemp` + "`" + ` && direnv \!* >! $_direnv_tmp && source $_direnv_tmp; rm -f $_direnv_tmp; unset _direnv_tmp'
+
+alias _direnv_check '_direnv_source export tcsh'
+
+alias direnv-apply '_direnv_source apply'
+alias direnv-restore '_direnv_source restore'
+alias direnv-info 'direnv info'
+alias direnv-enable 'direnv enable \!*'
+alias direnv-disable 'direnv disable \!*'
+
+# tcsh runs cwdcmd after every directory change (cd, pushd and popd). A
+# cwdcmd alias defined before keeps running first as _direnv_cwdcmd, and
+# sourcing this again doesn't chain direnv to itself. direnv leaves precmd
+# alone.
+set _direnv_cwdcmd = "` + "`" + `alias cwdcmd` + "`" + `"
+if ( "$_direnv_cwdcmd" =~ *_direnv_check* ) then
+    # Hooked by an earlier init already
+else if ( "$_direnv_cwdcmd" != "" ) then
+    alias _direnv_cwdcmd "$_direnv_cwdcmd"
+    alias cwdcmd '_direnv_cwdcmd; _direnv_check'
+else
+    alias cwdcmd _direnv_check
+endif
+unset _direnv_cwdcmd
+
+# Initial check for current directory
+_direnv_check
+
+# Load completions
+_direnv_source completion tcsh
+`
+
+const tcshCompletionScript = `# direnv tcsh completion
+# Candidates come from direnv __complete, which reads the command line
+# tcsh sets in COMMAND_LINE.
+complete direnv 'p/*/` + "`" + `direnv __complete --line` + "`" + `/'
+`
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2025 TierOne Software
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package shell
+
+import "fmt"
+
+type zsh struct{ bourne }
+
+func (z zsh) DefineFunction(name, script, projectRoot string) string {
+	// compdef only exists once the completion system is initialized
+	return z.localFunction(name, script, projectRoot) + fmt.Sprintf("\nif (( $+functions[compdef] )); then compdef _direnv_script %s; fi", name)
+}
+
+func (z zsh) RemoveFunction(name string) string {
+	return z.bourne.RemoveFunction(name) + fmt.Sprintf("\nif (( $+functions[compdef] )); then compdef -d %s; fi", name)
+}
+
+func (zsh) InitScript() string {
+	return zshInitScript
+}
+
+func (zsh) CompletionScript() string {
+	return zshCompletionScript
+}
+
+const zshInitScript = `# direnv - Directory Environment Manager
+# Add this to your ~/.zshrc
+
+export DIRENV_SHELL=zsh
+# Identifies this shell to direnv, also from subshells and pipelines
+export DIRENV_SHELL_PID=$$
+
+# direnv decides whether to apply, unload or do nothing. precmd runs it
+# once per prompt, after whatever changed the directory or the config.
+_direnv_hook() {
+    trap -- '' SIGINT
+    eval "$(direnv export zsh)"
+    trap - SIGINT
+}
+
+typeset -ag precmd_functions
+if (( ! ${precmd_functions[(I)_direnv_hook]} )); then
+    precmd_functions=(_direnv_hook $precmd_functions)
+fi
+
+direnv-apply() {
+    eval "$(direnv apply)"
+}
+
+direnv-restore() {
+    eval "$(direnv restore)"
+}
+
+direnv-info() {
+    direnv info
+}
+
+direnv-enable() {
+    direnv enable "$@"
+}
+
+direnv-disable() {
+    direnv disable "$@"
+}
+
+# Load completions if available
+if command -v direnv >/dev/null 2>&1; then
+    eval "$(direnv completion zsh 2>/dev/null)"
+fi
+`
+
+const zshCompletionScript = `# direnv zsh completion
+#compdef direnv
+
+# Candidates come from direnv __complete, which knows every command, flag
+# and script. ":files" asks for file names instead.
+_direnv_candidates() {
+    local -a described
+    local line
+    for line in "${(@f)$(direnv __complete "--current=${words[CURRENT]}" "$@" 2>/dev/null)}"; do
+        case $line in
+            '') ;;
+            :files) _files ;;
+            *$'\t'*) described+=("${${line%%$'\t'*}//:/\\:}:${line#*$'\t'}") ;;
+            *) described+=("${line//:/\\:}") ;;
+        esac
+    done
+    (( $#described )) && _describe 'direnv' described
+}
+
+_direnv() {
+    _direnv_candidates "${(@)words[2,CURRENT-1]}"
+}
+
+# Completes a script exported as a function like direnv run <script>
+_direnv_script() {
+    _direnv_candidates run "${(@)words[1,CURRENT-1]}"
+}
+
+compdef _direnv direnv
+`